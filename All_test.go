@@ -1,9 +1,26 @@
 package easyFS
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestPathHandler(t *testing.T) {
@@ -319,3 +336,2153 @@ func TestFile(t *testing.T) {
 	//delete dir
 	dir.Delete(true)
 }
+
+// countingFS wraps the OS backend and counts the calls routed through it.
+type countingFS struct {
+	OSFileSystem
+	calls int
+}
+
+func (c *countingFS) Stat(name string) (os.FileInfo, error) {
+	c.calls++
+	return c.OSFileSystem.Stat(name)
+}
+
+func (c *countingFS) ReadDir(name string) ([]os.DirEntry, error) {
+	c.calls++
+	return c.OSFileSystem.ReadDir(name)
+}
+
+func TestFileSystemMount(t *testing.T) {
+	root := PathHandler(t.TempDir())
+	fsys := &countingFS{}
+	Mount(root, fsys)
+	defer Unmount(root)
+
+	if root.Join("a", "b").FileSystem() != FileSystem(fsys) {
+		t.Error("paths below the mount point should use the mounted backend")
+	}
+	if PathHandler("somewhere/else").FileSystem() == FileSystem(fsys) {
+		t.Error("paths outside the mount point should use the default backend")
+	}
+
+	dir := root.Dir()
+	if _, err := dir.CreateFileWithData("file.txt", []byte("data"), true); err != nil {
+		t.Fatal(err)
+	}
+	if files, err := dir.Files(); err != nil || len(files) != 1 {
+		t.Error("Files failed. got:", files, err)
+	}
+	if fsys.calls == 0 {
+		t.Error("operations should be routed through the mounted backend")
+	}
+
+	// a backend that cannot be compared with == must not make moves panic
+	other := PathHandler(t.TempDir())
+	Mount(other, mapFS{OSFileSystem{}, map[string]int{}})
+	defer Unmount(other)
+	moved := dir.Join("file.txt")
+	if err := moved.Move(other); err != nil || !other.Join("file.txt").Exists() {
+		t.Errorf("moving to a non-comparable backend failed: %v", err)
+	}
+	if err := moved.Rename("renamed.txt"); err != nil || !other.Join("renamed.txt").Exists() {
+		t.Errorf("renaming within a non-comparable backend failed: %v", err)
+	}
+}
+
+// mapFS is a backend value that cannot be compared with ==.
+type mapFS struct {
+	OSFileSystem
+	state map[string]int
+}
+
+func TestMemFileSystem(t *testing.T) {
+	root := PathHandler(string(os.PathSeparator) + "easyfs-mem-test")
+	mem := NewMemFileSystem()
+	Mount(root, mem)
+	defer Unmount(root)
+
+	dir := root.Join("project").Dir()
+	if err := dir.CreateIfNotExist(); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := dir.CreateSubdir("sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := dir.CreateFileWithData("a.txt", []byte("line1"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.AppendString("line2", true); err != nil {
+		t.Error("AppendString failed:", err)
+	}
+	data, err := file.ReadString()
+	if err != nil || data != "line1\nline2" {
+		t.Error("ReadString failed. got:", data, err)
+	}
+	next, err := file.IterateLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := next(); line != "line1" {
+		t.Error("IterateLine failed. got:", line)
+	}
+	reader, closer, err := file.ChunkReader(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk, _, _ := reader(); string(chunk) != "line1" {
+		t.Error("ChunkReader failed. got:", string(chunk))
+	}
+	closer()
+
+	if err := file.SetPerm(0600); err != nil {
+		t.Error(err)
+	}
+	if info, _ := file.Stat(); info.Mode().Perm() != 0600 || info.ModTime().IsZero() {
+		t.Error("mode or mtime not kept. got:", info.Mode(), info.ModTime())
+	}
+	if _, err := file.Copy(sub); err != nil || !sub.HasFile("a.txt") {
+		t.Error("Copy failed:", err)
+	}
+	if found := dir.FindFile("*.txt", true, 0); len(found) == 0 {
+		t.Error("FindFile should find a.txt")
+	}
+	tree := dir.GetTree()
+	if len(tree.Files) != 1 || len(tree.Dirs) != 1 {
+		t.Error("GetTree failed. got:", tree)
+	}
+	if err := dir.Delete(false); err == nil {
+		t.Error("deleting a non-empty directory should fail")
+	}
+	if err := dir.Clear(true); err != nil || !dir.IsEmpty() {
+		t.Error("Clear failed:", err)
+	}
+	if _, err := os.Stat(dir.String()); err == nil {
+		t.Error("the in-memory tree should not touch the disk")
+	}
+}
+
+func TestMemFileSystemConcurrent(t *testing.T) {
+	root := PathHandler(string(os.PathSeparator) + "easyfs-mem-concurrent")
+	Mount(root, NewMemFileSystem())
+	defer Unmount(root)
+
+	dir := root.Dir()
+	dir.CreateIfNotExist()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sub, err := dir.CreateSubdir(fmt.Sprint("dir", i%4))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := sub.CreateFileWithData(fmt.Sprint("file", i), []byte("data"), true); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if paths := dir.GetAllPathExists(); len(paths) != 24 {
+		t.Error("expected 24 paths. got:", len(paths))
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	sub, _ := dir.CreateSubdir("sub")
+	dir.CreateFileWithString("a.txt", "hello", true)
+	sub.CreateFileWithString("b.txt", "world", true)
+
+	if err := fstest.TestFS(dir.FS(), "a.txt", "sub/b.txt"); err != nil {
+		t.Error(err)
+	}
+	data, err := fs.ReadFile(dir.FS(), "sub/b.txt")
+	if err != nil || string(data) != "world" {
+		t.Error("ReadFile failed. got:", string(data), err)
+	}
+}
+
+func TestFromFS(t *testing.T) {
+	dir := FromFS(fstest.MapFS{
+		"a.txt":     {Data: []byte("hello"), Mode: 0644},
+		"sub/b.txt": {Data: []byte("world"), Mode: 0644},
+	})
+	defer Unmount(dir.PathHandler)
+
+	if !dir.HasFile("a.txt") || !dir.HasDir("sub") {
+		t.Error("FromFS should expose the files of the fs.FS")
+	}
+	data, err := dir.Join("sub", "b.txt").File().ReadString()
+	if err != nil || data != "world" {
+		t.Error("ReadString failed. got:", data, err)
+	}
+	if paths := dir.GetAllPathExists(); len(paths) != 3 {
+		t.Error("GetAllPathExists failed. got:", paths)
+	}
+	if err := dir.Join("a.txt").File().WriteString("changed"); err == nil {
+		t.Error("writing to an fs.FS tree should fail")
+	}
+	if err := fstest.TestFS(dir.FS(), "a.txt", "sub/b.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestContextOperations(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	src, _ := dir.CreateSubdir("src")
+	sub, _ := src.CreateSubdir("sub")
+	sub.CreateFileWithString("a.txt", "hello", true)
+	deep, _ := sub.CreateSubdir("deep")
+	deep.CreateFileWithString("b.txt", "deep", true)
+	src.CreateFileWithString("top.txt", "top", true)
+	dest := dir.Join("dest")
+
+	if err := src.CopyContext(context.Background(), dest); err != nil {
+		t.Fatal(err)
+	}
+	var layout []string
+	dest.Dir().Walk(func(entry WalkEntry, err error) error {
+		rel, _ := filepath.Rel(dest.String(), entry.Path.String())
+		layout = append(layout, filepath.ToSlash(rel))
+		return nil
+	})
+	want := []string{"sub", "sub/a.txt", "sub/deep", "sub/deep/b.txt", "top.txt"}
+	if slices.Sort(layout); !slices.Equal(layout, want) {
+		t.Errorf("Copy should nest subdirectories like the source, got %v", layout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := src.CopyContext(ctx, dir.Join("cancelled"))
+	var fsErr *Error
+	if !errors.Is(err, context.Canceled) || !errors.As(err, &fsErr) || fsErr.Path != src.String() {
+		t.Error("CopyContext should report the cancellation with the path. got:", err)
+	}
+	if _, err := sub.Join("a.txt").File().CopyContext(ctx, dir); !errors.Is(err, context.Canceled) {
+		t.Error("File.CopyContext should fail on a cancelled context. got:", err)
+	}
+	if dir.HasFile("a.txt") {
+		t.Error("a cancelled copy should not leave a destination file")
+	}
+	if _, err := src.FindContext(ctx, "*", true, -1); !errors.Is(err, context.Canceled) {
+		t.Error("FindContext should fail on a cancelled context. got:", err)
+	}
+	if _, err := src.GetAllPathExistsContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Error("GetAllPathExistsContext should fail on a cancelled context. got:", err)
+	}
+	if err := src.ClearContext(ctx, true); !errors.Is(err, context.Canceled) || src.IsEmpty() {
+		t.Error("ClearContext should stop on a cancelled context. got:", err)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	for _, name := range []string{"b", "a", "a/x", "c"} {
+		dir.Join(name).Dir().CreateIfNotExist()
+	}
+	dir.CreateFileWithString("a/x/deep.txt", "", true)
+	dir.CreateFileWithString("b/file.txt", "", true)
+	dir.CreateFileWithString("top.txt", "", true)
+
+	var visited []string
+	err := dir.Walk(func(entry WalkEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir.String(), entry.Path.String())
+		visited = append(visited, filepath.ToSlash(rel))
+		if entry.IsDir() && entry.Path.Name() == "b" {
+			return SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "a a/x a/x/deep.txt b c top.txt"
+	if strings.Join(visited, " ") != expected {
+		t.Error("Walk order failed. got:", visited, "expected:", expected)
+	}
+
+	count := 0
+	dir.WalkContext(context.Background(), WalkOptions{MaxDepth: 1}, func(entry WalkEntry, err error) error {
+		if entry.Depth > 1 {
+			t.Error("MaxDepth exceeded:", entry.Path)
+		}
+		count++
+		return nil
+	})
+	if count != 4 {
+		t.Error("MaxDepth 1 should visit 4 entries. got:", count)
+	}
+
+	count = 0
+	for range dir.WalkSeq(context.Background(), WalkOptions{}) {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	if count != 2 {
+		t.Error("breaking out of WalkSeq should stop the walk")
+	}
+
+	if found := dir.FindFile("*/*.txt", true, 1); len(found) != 1 {
+		t.Error("FindFile should stop after quantity matches. got:", found)
+	}
+	if found := dir.FindDir("*", true, 0); len(found) != 4 {
+		t.Error("FindDir with quantity 0 should return all matches. got:", found)
+	}
+}
+
+func TestWalkSymlinkLoop(t *testing.T) {
+	mem := PathHandler(string(os.PathSeparator) + "easyfs-walk-test")
+	Mount(mem, NewMemFileSystem())
+	defer Unmount(mem)
+	mem.Dir().CreateIfNotExist()
+
+	for _, dir := range []Dir{NewDir(PathHandler(t.TempDir())), mem.Dir()} {
+		dir.Join("a").Dir().CreateIfNotExist()
+		dir.CreateFileWithString("a/file.txt", "", true)
+		if err := PathHandler("..").Symlink(dir.Join("a", "loop")); err != nil {
+			t.Fatal(err)
+		}
+
+		var visited []string
+		var loops []PathHandler
+		err := dir.WalkContext(context.Background(), WalkOptions{FollowSymlinks: true}, func(entry WalkEntry, err error) error {
+			if err != nil {
+				loops = append(loops, entry.Path)
+				return nil
+			}
+			visited = append(visited, dir.rel(entry.Path))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(visited, " ") != "a a/file.txt a/loop" {
+			t.Error("a link loop should be visited once. got:", visited)
+		}
+		if len(loops) != 1 || loops[0] != dir.Join("a", "loop") {
+			t.Error("a link loop should be reported. got:", loops)
+		}
+
+		found, err := dir.FindWith(context.Background(), MustCompilePattern("**"), FindOptions{WalkOptions: WalkOptions{FollowSymlinks: true}})
+		if err != nil || len(found) != 3 {
+			t.Error("Find should not follow a link loop. got:", found, err)
+		}
+	}
+}
+
+func TestPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*.txt", "a.txt", true},
+		{"*.txt", "deep/dir/a.txt", true},
+		{"*.txt", "a.go", false},
+		{"src/*.go", "src/a.go", true},
+		{"src/*.go", "src/pkg/a.go", false},
+		{"src/**/*_test.go", "src/a_test.go", true},
+		{"src/**/*_test.go", "src/x/y/a_test.go", true},
+		{"src/**/*_test.go", "lib/a_test.go", false},
+		{"**/*.{go,md}", "a/b/README.md", true},
+		{"**/*.{go,md}", "a/b/c.txt", false},
+		{"{src,lib/{x,y}}/*.go", "lib/y/a.go", true},
+		{"[a-c]?.txt", "b1.txt", true},
+		{"[!a-c]?.txt", "b1.txt", false},
+		{`\[!x]`, "[!x]", true},
+		{`\[!x]`, "[y]", false},
+		{"[[!]", "!", true},
+		{"[{a,b}]", "{", true},
+		{"[{a,b}]", ",", true},
+		{"x[{,]{y,z}", "x,z", true},
+		{`\{a,b\}`, "{a,b}", true},
+		{"!*.txt", "a.go", true},
+		{"!*.txt", "a.txt", false},
+		{"docs/**", "docs/a/b", true},
+	}
+	for _, c := range cases {
+		if got := MustCompilePattern(c.pattern).Match(c.name); got != c.match {
+			t.Error("pattern", c.pattern, "on", c.name, "expected", c.match, "got", got)
+		}
+	}
+	if _, err := CompilePattern("{a,b"); err == nil {
+		t.Error("unbalanced braces should fail to compile")
+	}
+	if _, err := CompilePattern("[a-"); err == nil {
+		t.Error("invalid character classes should fail to compile")
+	}
+
+	dir := NewDir(PathHandler(t.TempDir()))
+	dir.Join("src", "pkg").Dir().CreateIfNotExist()
+	dir.CreateFileWithString("src/pkg/a_test.go", "", true)
+	dir.CreateFileWithString("src/a.go", "", true)
+	dir.CreateFileWithString("b_test.go", "", true)
+	if found := dir.FindFilePattern(MustCompilePattern("src/**/*_test.go"), true, 0); len(found) != 1 {
+		t.Error("FindFilePattern failed. got:", found)
+	}
+	if found := dir.FindFile("*_test.go", true, 0); len(found) != 2 {
+		t.Error("FindFile should match base names at any depth. got:", found)
+	}
+	if found := dir.FindFile("*_test.go", false, 0); len(found) != 1 {
+		t.Error("FindFile should not descend when not recursive. got:", found)
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	for _, name := range []string{"node_modules/pkg", "src/build", "build", "docs"} {
+		dir.Join(name).Dir().CreateIfNotExist()
+	}
+	dir.CreateFileWithString(".gitignore", "node_modules/\n/build\n*.log\n!keep.log\n# comment\n", true)
+	dir.CreateFileWithString("src/.gitignore", "*.tmp\n", true)
+	dir.CreateFileWithString("node_modules/pkg/index.js", "", true)
+	dir.CreateFileWithString("src/main.go", "", true)
+	dir.CreateFileWithString("src/cache.tmp", "", true)
+	dir.CreateFileWithString("src/build/out.go", "", true)
+	dir.CreateFileWithString("build/out.go", "", true)
+	dir.CreateFileWithString("docs/debug.log", "", true)
+	dir.CreateFileWithString("docs/keep.log", "", true)
+	dir.CreateFileWithString("docs/cache.tmp", "", true)
+
+	ignore := GitIgnore(dir)
+	cases := map[string]bool{
+		"node_modules":              true,
+		"node_modules/pkg/index.js": true,
+		"build":                     true,
+		"build/out.go":              true,
+		"src/build/out.go":          false,
+		"src/cache.tmp":             true,
+		"docs/cache.tmp":            false,
+		"docs/debug.log":            true,
+		"docs/keep.log":             false,
+		"src/main.go":               false,
+	}
+	for name, expected := range cases {
+		p := dir.Join(filepath.FromSlash(name))
+		if got := ignore.Match(p, p.IsDir()); got != expected {
+			t.Error("Match", name, "expected", expected, "got", got)
+		}
+	}
+
+	opts := FindOptions{WalkOptions: WalkOptions{Ignore: ignore}, Type: FindFiles}
+	found, err := dir.FindWith(context.Background(), MustCompilePattern("*.go"), opts)
+	if err != nil || len(found) != 2 {
+		t.Error("FindWith should skip ignored paths. got:", found, err)
+	}
+
+	dest := PathHandler(t.TempDir())
+	if err := dir.CopyWith(context.Background(), dest, CopyOptions{Ignore: ignore}); err != nil {
+		t.Fatal(err)
+	}
+	if dest.Join("node_modules").Exists() || dest.Join("docs", "debug.log").Exists() || !dest.Join("docs", "keep.log").Exists() {
+		t.Error("CopyWith should skip ignored paths")
+	}
+
+	tree := dir.GetTreeWith(WalkOptions{Ignore: ignore})
+	if _, ok := tree.Dirs[dir.Join("node_modules").String()]; ok || len(tree.Dirs) != 2 {
+		t.Error("GetTreeWith should skip ignored directories. got:", tree.Dirs)
+	}
+}
+
+func TestAtomicWrite(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	file, err := dir.CreateFileWithData("config.json", []byte("old"), false, WriteOptions{Atomic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.SetPerm(0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.WriteStringAtomic("new"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := file.ReadString(); data != "new" {
+		t.Error("WriteAtomic failed. got:", data)
+	}
+	if info, _ := file.Stat(); IsUnix() && info.Mode().Perm() != 0600 {
+		t.Error("WriteAtomic should keep the permissions. got:", info.Mode())
+	}
+	if _, err := dir.CreateFileWithData("config.json", []byte("x"), false, WriteOptions{Atomic: true}); !errors.Is(err, os.ErrExist) {
+		t.Error("an atomic CreateFileWithData without overwrite should fail. got:", err)
+	}
+	if data, _ := file.ReadString(); data != "new" {
+		t.Error("a failed exclusive creation should leave the file untouched. got:", data)
+	}
+
+	link := dir.Join("current.json")
+	PathHandler("config.json").Symlink(link)
+	if err := link.File().WriteStringAtomic("through link"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := file.ReadString(); !link.IsSymlink() || data != "through link" {
+		t.Errorf("writing through a link should replace its target and keep the link, got %q", data)
+	}
+	link.File().Delete()
+	file.WriteStringAtomic("new")
+
+	// new files get 0666 for the umask to restrict, which the memory backend
+	// does not apply
+	mem := PathHandler(string(os.PathSeparator) + "easyfs-atomic-test")
+	Mount(mem, NewMemFileSystem())
+	defer Unmount(mem)
+	mem.Dir().CreateIfNotExist()
+	fresh, err := mem.Dir().CreateFileWithData("new.txt", []byte("new"), false, WriteOptions{Atomic: true})
+	if info, _ := fresh.Stat(); err != nil || info.Mode().Perm() != 0666 {
+		t.Errorf("a new file should be created like os.Create, got %v %v", info, err)
+	}
+
+	var created atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := dir.CreateFileWithData("race.txt", []byte(strconv.Itoa(i)), false, WriteOptions{Atomic: true}); err == nil {
+				created.Add(1)
+			} else if !errors.Is(err, os.ErrExist) {
+				t.Error("a losing exclusive creation should fail with ErrExist. got:", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if created.Load() != 1 {
+		t.Error("exactly one exclusive creation should succeed. got:", created.Load())
+	}
+	dir.Join("race.txt").File().Delete()
+
+	w, err := file.CreateAtomic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("aborted"))
+	w.Abort()
+	if data, _ := file.ReadString(); data != "new" {
+		t.Error("Abort should leave the file untouched. got:", data)
+	}
+	if all, _ := dir.All(); len(all) != 1 {
+		t.Error("no temporary files should be left behind. got:", all)
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	file := dir.Join("shared.log").File()
+
+	lock, err := file.Lock()
+	if err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			t.Skip("file locking is not supported on this platform")
+		}
+		t.Fatal(err)
+	}
+	if _, err := file.TryLock(); !errors.Is(err, ErrLocked) {
+		t.Error("TryLock should fail while the lock is held. got:", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := file.LockContext(ctx, true); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("LockContext should time out. got:", err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Error(err)
+	}
+
+	r1, err1 := file.TryRLock()
+	r2, err2 := file.TryRLock()
+	if err1 != nil || err2 != nil {
+		t.Error("shared locks should not exclude each other:", err1, err2)
+	} else {
+		r1.Unlock()
+		r2.Unlock()
+	}
+
+	err = file.WithLock(func() error {
+		return file.AppendString("entry", false)
+	})
+	if data, _ := file.ReadString(); err != nil || data != "entry" {
+		t.Error("WithLock failed. got:", data, err)
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	lock := dir.LockFile()
+	if err := lock.TryLock(); err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := lock.Owner(); err != nil || pid != os.Getpid() {
+		t.Error("Owner should be this process. got:", pid, err)
+	}
+	var fsErr *Error
+	if err := dir.LockFile().TryLock(); !errors.Is(err, ErrLocked) || !errors.As(err, &fsErr) || fsErr.Path != lock.Path().String() {
+		t.Error("a held lock file should not be acquired twice. got:", err)
+	}
+	if err := lock.Unlock(); err != nil || lock.Path().Exists() {
+		t.Error("Unlock should remove the lock file:", err)
+	}
+
+	// a lock left behind by a process that no longer runs is stale
+	lock.Path().File().WriteString("999999999\n")
+	if err := lock.TryLock(); err != nil {
+		t.Error("a stale lock file should be taken over. got:", err)
+	}
+
+	// a lock taken over by someone else is not removed by its former holder
+	lock.Path().File().WriteString("1 other\n")
+	if err := lock.Unlock(); !errors.Is(err, ErrLocked) || !lock.Path().Exists() {
+		t.Error("Unlock should leave a lock it no longer holds. got:", err)
+	}
+	lock.Path().File().Delete()
+
+	// of several contenders finding the same stale lock only one gets it
+	for round := 0; round < 20; round++ {
+		lock.Path().File().WriteString("999999999\n")
+		var held atomic.Int32
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := dir.LockFile().TryLock(); err == nil {
+					held.Add(1)
+				} else if !errors.Is(err, ErrLocked) {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		if held.Load() != 1 {
+			t.Fatal("exactly one contender should take over a stale lock. got:", held.Load())
+		}
+		if all, _ := dir.Parent().All(); len(all) != 2 {
+			t.Error("only the lock file should be left next to the directory. got:", all)
+		}
+		lock.Path().File().Delete()
+	}
+}
+
+// nextEvent waits for the next event on w matching op and name.
+func nextEvent(t *testing.T, w *Watcher, op WatchOp, name string) WatchEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-w.Events:
+			if event.Op.Has(op) && event.Path.Name() == name {
+				return event
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for", op, name)
+			return WatchEvent{}
+		}
+	}
+}
+
+func testWatcher(t *testing.T, dir Dir, opts WatchOptions) {
+	opts.Recursive = true
+	opts.PollInterval = 10 * time.Millisecond
+	w, err := dir.Watch(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	file, _ := dir.CreateFileWithData("a.txt", []byte("one"), true)
+	nextEvent(t, w, WatchCreate, "a.txt")
+	time.Sleep(20 * time.Millisecond)
+	file.AppendString("two", true)
+	nextEvent(t, w, WatchWrite, "a.txt")
+
+	sub, _ := dir.CreateSubdir("sub")
+	nextEvent(t, w, WatchCreate, "sub")
+	time.Sleep(20 * time.Millisecond)
+	sub.CreateFileWithString("b.txt", "", true)
+	if event := nextEvent(t, w, WatchCreate, "b.txt"); event.Path.Parent().Name() != "sub" {
+		t.Error("new subdirectories should be watched. got:", event)
+	}
+	sub.CreateFileWithString("skip.log", "", true)
+	file.Delete()
+	nextEvent(t, w, WatchRemove, "a.txt")
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+	for event := range w.Events {
+		if event.Path.Name() == "skip.log" {
+			t.Error("events not matching the pattern should be filtered. got:", event)
+		}
+	}
+}
+
+func TestWatchNative(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	w, err := dir.Watch(WatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Polling() != (runtime.GOOS != "linux") {
+		t.Errorf("the OS backend should use inotify exactly on Linux, polling: %v", w.Polling())
+	}
+	select {
+	case err := <-w.Errors:
+		t.Errorf("starting the watcher should not fail: %v", err)
+	default:
+	}
+	w.Close()
+	if w, _ := dir.Watch(WatchOptions{ForcePolling: true}); !w.Polling() {
+		t.Error("ForcePolling should poll")
+	} else {
+		w.Close()
+	}
+	testWatcher(t, dir, WatchOptions{Pattern: MustCompilePattern("!*.log")})
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	// a directory moved out of the tree is no longer watched under its old path
+	tree, _ := dir.CreateSubdir("tree")
+	tree.CreateSubdir("away")
+	w, err = tree.Watch(WatchOptions{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	outside := NewDir(PathHandler(t.TempDir()))
+	if err := os.Rename(tree.Join("away").String(), outside.Join("away").String()); err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, w, WatchRename, "away")
+	outside.Join("away").Dir().CreateFileWithString("late.txt", "x", true)
+	tree.CreateFileWithString("marker.txt", "x", true)
+	timeout := time.After(5 * time.Second)
+	for marker := false; !marker; {
+		select {
+		case event := <-w.Events:
+			if event.Path.Name() == "late.txt" {
+				t.Errorf("a file in a directory moved away should not be reported: %v", event)
+			}
+			marker = event.Path == tree.Join("marker.txt")
+		case <-timeout:
+			t.Fatal("timed out waiting for marker.txt")
+		}
+	}
+}
+
+func TestWatchPolling(t *testing.T) {
+	root := PathHandler(string(os.PathSeparator) + "easyfs-watch-test")
+	Mount(root, NewMemFileSystem())
+	defer Unmount(root)
+	root.Dir().CreateIfNotExist()
+	testWatcher(t, root.Dir(), WatchOptions{Pattern: MustCompilePattern("!*.log")})
+}
+
+func TestWatchDebounce(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	file, _ := dir.CreateFileWithData("burst.txt", nil, true)
+	w, err := dir.Watch(WatchOptions{Debounce: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for i := 0; i < 10; i++ {
+		file.AppendString("x", false)
+	}
+	nextEvent(t, w, WatchWrite, "burst.txt")
+	select {
+	case event := <-w.Events:
+		t.Error("a burst should be coalesced into one event. got extra:", event)
+	case <-time.After(250 * time.Millisecond):
+	}
+
+	// a path that keeps changing does not hold back the others
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+				file.AppendString("x", false)
+			}
+		}
+	}()
+	defer wg.Wait()
+	defer close(stop)
+	dir.CreateFileWithString("quiet.txt", "x", true)
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-w.Events:
+			if event.Path.Name() == "quiet.txt" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("quiet.txt was held back by a path that keeps changing")
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	empty, _ := dir.CreateFileWithData("empty", nil, true)
+	abc, _ := dir.CreateFileWithData("abc", []byte("abc"), true)
+	long, _ := dir.CreateFileWithData("long", []byte(strings.Repeat("a", 1000)), true)
+	for _, test := range []struct {
+		file File
+		algo HashAlgorithm
+		want string
+	}{
+		{abc, SHA256, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{abc, SHA1, "a9993e364706816aba3e25717850c26c9cd0d89d"},
+		{abc, MD5, "900150983cd24fb0d6963f7d28e17f72"},
+		{abc, CRC32, "352441c2"},
+		{abc, BLAKE2b512, "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+		{empty, BLAKE2b512, "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+		{empty, BLAKE2b256, "0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8"},
+	} {
+		got, err := test.file.Hash(test.algo)
+		if err != nil || got != test.want {
+			t.Error(test.algo, "of", test.file.Name(), "is wrong. got:", got, err, "want:", test.want)
+		}
+	}
+	// inputs longer than a block must hash the same however they are written
+	sum, _ := long.Hash(BLAKE2b256)
+	h, _ := BLAKE2b256.New()
+	for i := 0; i < 1000; i += 7 {
+		h.Write([]byte(strings.Repeat("a", min(7, 1000-i))))
+	}
+	if fmt.Sprintf("%x", h.Sum(nil)) != sum {
+		t.Error("blake2b should not depend on how the input is split")
+	}
+	if _, err := abc.Hash("sha3"); err == nil {
+		t.Error("an unknown algorithm should fail")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	dir.CreateFileWithString("a.txt", "alpha", true)
+	sub, _ := dir.CreateSubdir("sub")
+	sub.CreateFileWithString("b.txt", "beta", true)
+	sub.CreateFileWithString("c.txt", "gamma", true)
+	manifest := dir.Join("SHA256SUMS").File()
+	if err := dir.WriteManifest(manifest, SHA256); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := manifest.ReadString()
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "  a.txt") || !strings.HasSuffix(lines[2], "  sub/c.txt") {
+		t.Error("manifest should list every file but itself in sha256sum format. got:", content)
+	}
+	report, err := dir.VerifyManifest(manifest, SHA256)
+	if err != nil || !report.OK() || len(report.Matched) != 3 {
+		t.Error("an unchanged tree should verify. got:", report, err)
+	}
+
+	sub.Join("b.txt").File().WriteString("changed")
+	sub.DeleteSubFile("c.txt")
+	dir.CreateFileWithString("new.txt", "new", true)
+	report, err = dir.VerifyManifest(manifest, SHA256)
+	if err != nil || report.OK() {
+		t.Fatal("a changed tree should not verify. got:", report, err)
+	}
+	if len(report.Mismatched) != 1 || report.Mismatched[0].Path != "sub/b.txt" {
+		t.Error("changed file should be mismatched. got:", report.Mismatched)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "sub/c.txt" {
+		t.Error("deleted file should be missing. got:", report.Missing)
+	}
+	if len(report.Extra) != 1 || report.Extra[0] != "new.txt" {
+		t.Error("new file should be extra. got:", report.Extra)
+	}
+
+	manifest.WriteString("not a checksum line\n")
+	if _, err := dir.VerifyManifest(manifest, SHA256); err == nil {
+		t.Error("a malformed manifest should fail")
+	}
+
+	outside := NewDir(PathHandler(t.TempDir())).CreateFileWithString("secret.txt", "secret", true)
+	sum, _ := outside.Hash(SHA256)
+	for _, name := range []string{"../" + outside.Name(), "sub/../../" + outside.Name(), filepath.ToSlash(outside.String())} {
+		manifest.WriteString(sum + "  " + name + "\n")
+		if _, err := dir.VerifyManifest(manifest, SHA256); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("a manifest entry %q should fail with ErrPathEscape, got %v", name, err)
+		}
+	}
+
+	// links inside the directory are not followed out of it
+	outside.PathHandler.Symlink(dir.Join("link.txt"))
+	outside.Parent().PathHandler.Symlink(dir.Join("linked"))
+	manifest.WriteString(sum + "  link.txt\n" + sum + "  linked/" + outside.Name() + "\n")
+	report, err = dir.VerifyManifest(manifest, SHA256)
+	if err != nil || len(report.Matched) != 0 || len(report.Mismatched) != 2 || report.Mismatched[0].Actual != "" {
+		t.Error("entries through symbolic links should be mismatched. got:", report, err)
+	}
+}
+
+func TestSyncTo(t *testing.T) {
+	src := NewDir(PathHandler(t.TempDir()))
+	dest := PathHandler(t.TempDir()).Join("mirror")
+	src.CreateFileWithString("a.txt", "alpha", true)
+	src.CreateFileWithString("skip.tmp", "temp", true)
+	sub, _ := src.CreateSubdir("sub")
+	sub.CreateFileWithString("b.txt", "beta", true)
+	opts := SyncOptions{Delete: true, Exclude: MustCompilePattern("*.tmp")}
+
+	report, err := src.SyncTo(dest, opts)
+	if err != nil || len(report.Added) != 3 || len(report.Updated)+len(report.Deleted)+len(report.Skipped) != 0 {
+		t.Fatal("first sync should add everything but excluded files. got:", report, err)
+	}
+	if dest.Join("skip.tmp").Exists() || !dest.Join("sub", "b.txt").IsFile() {
+		t.Error("destination should mirror the source")
+	}
+
+	report, err = src.SyncTo(dest, opts)
+	if err != nil || len(report.Skipped) != 2 || len(report.Added)+len(report.Updated)+len(report.Deleted) != 0 {
+		t.Error("an unchanged tree should be skipped. got:", report, err)
+	}
+
+	sub.Join("b.txt").File().WriteString("beta, changed")
+	src.DeleteSubFile("a.txt")
+	dest.Dir().CreateFileWithString("keep.tmp", "excluded files are protected", true)
+	dry, err := src.SyncTo(dest, SyncOptions{Delete: true, Exclude: opts.Exclude, DryRun: true})
+	if err != nil || len(dry.Updated) != 1 || len(dry.Deleted) != 1 || !dest.Join("a.txt").Exists() {
+		t.Error("dry run should report without changing anything. got:", dry, err)
+	}
+	report, err = src.SyncTo(dest, opts)
+	if err != nil || fmt.Sprint(report) != fmt.Sprint(dry) {
+		t.Error("sync should do what the dry run reported. got:", report, err, "want:", dry)
+	}
+	if content, _ := dest.Join("sub", "b.txt").File().ReadString(); content != "beta, changed" {
+		t.Error("changed file should be updated. got:", content)
+	}
+	if dest.Join("a.txt").Exists() || !dest.Join("keep.tmp").Exists() {
+		t.Error("extraneous files should be deleted and excluded ones kept")
+	}
+
+	// same size and time, different content: only a checksum notices
+	info, _ := dest.Join("sub", "b.txt").Stat()
+	dest.Join("sub", "b.txt").File().WriteString("BETA, CHANGED")
+	dest.Join("sub", "b.txt").SetModTime(info.ModTime())
+	if report, _ := src.SyncTo(dest, opts); len(report.Updated) != 0 {
+		t.Error("size and time comparison should skip the file. got:", report)
+	}
+	report, err = src.SyncTo(dest, SyncOptions{Checksum: true, Include: MustCompilePattern("*.txt")})
+	if err != nil || len(report.Updated) != 1 || report.Updated[0] != "sub/b.txt" {
+		t.Error("checksum comparison should update the file. got:", report, err)
+	}
+
+	// times stored less precisely by the destination count as equal within
+	// ModifyWindow, but by default any difference is a change
+	srcInfo, _ := sub.Join("b.txt").Stat()
+	dest.Join("sub", "b.txt").SetModTime(srcInfo.ModTime().Add(-600 * time.Millisecond))
+	if report, err := src.SyncTo(dest, SyncOptions{Exclude: opts.Exclude, ModifyWindow: time.Second}); err != nil || len(report.Updated) != 0 {
+		t.Error("times within ModifyWindow should be taken as equal. got:", report, err)
+	}
+	if report, err := src.SyncTo(dest, opts); err != nil || strings.Join(report.Updated, " ") != "sub/b.txt" {
+		t.Error("without ModifyWindow times should be equal. got:", report, err)
+	}
+
+	// a same-sized edit only half a second later is synced
+	edited := src.CreateFileWithString("edit.txt", "v1", true)
+	src.SyncTo(dest, opts)
+	edited.WriteString("v2")
+	info, _ = edited.Stat()
+	edited.SetModTime(info.ModTime().Add(500 * time.Millisecond))
+	dest.Join("edit.txt").SetModTime(info.ModTime())
+	if report, err := src.SyncTo(dest, opts); err != nil || strings.Join(report.Updated, " ") != "edit.txt" {
+		t.Error("a same-sized edit should be synced. got:", report, err)
+	}
+	if content, _ := dest.Join("edit.txt").File().ReadString(); content != "v2" {
+		t.Error("the edit should reach the destination. got:", content)
+	}
+	edited.Delete()
+	src.SyncTo(dest, opts)
+
+	// a directory replacing a file is reported by a dry run too
+	dest.Join("sub").Dir().Delete(true)
+	dest.Dir().CreateFileWithString("sub", "a file in the way", true)
+	dry, err = src.SyncTo(dest, SyncOptions{Delete: true, Exclude: opts.Exclude, DryRun: true})
+	if err != nil || strings.Join(dry.Updated, " ") != "sub" || strings.Join(dry.Added, " ") != "sub/b.txt" || !dest.Join("sub").IsFile() {
+		t.Fatal("a dry run should report a file replaced by a directory. got:", dry, err)
+	}
+	report, err = src.SyncTo(dest, opts)
+	if err != nil || fmt.Sprint(report) != fmt.Sprint(dry) || !dest.Join("sub", "b.txt").IsFile() {
+		t.Error("sync should replace the file as the dry run reported. got:", report, err, "want:", dry)
+	}
+
+	// links are synced as links: neither a dangling one nor a loop is followed
+	PathHandler("missing.txt").Symlink(src.Join("dangling"))
+	PathHandler("..").Symlink(sub.Join("up"))
+	report, err = src.SyncTo(dest, opts)
+	if err != nil || strings.Join(report.Added, " ") != "dangling sub/up" {
+		t.Fatal("links should be added as links. got:", report, err)
+	}
+	if target, err := dest.Join("sub", "up").Readlink(); err != nil || target != ".." {
+		t.Error("a link to an ancestor should be recreated. got:", target, err)
+	}
+	if target, err := dest.Join("dangling").Readlink(); err != nil || target != "missing.txt" {
+		t.Error("a dangling link should be recreated. got:", target, err)
+	}
+	report, err = src.SyncTo(dest, opts)
+	if err != nil || len(report.Added)+len(report.Updated)+len(report.Deleted) != 0 {
+		t.Error("unchanged links should be skipped. got:", report, err)
+	}
+}
+
+func TestSyncToReadOnlyDir(t *testing.T) {
+	if IsWindows() {
+		t.Skip("directory permissions do not restrict writes on Windows")
+	}
+	src := NewDir(PathHandler(t.TempDir()))
+	dest := PathHandler(t.TempDir()).Join("mirror")
+	locked, _ := src.CreateSubdir("locked")
+	locked.CreateFileWithString("a.txt", "a", true)
+	locked.SetPerm(0555)
+	t.Cleanup(func() {
+		locked.SetPerm(0755)
+		dest.Join("locked").SetPerm(0755)
+	})
+	report, err := src.SyncTo(dest, SyncOptions{})
+	if err != nil || strings.Join(report.Added, " ") != "locked locked/a.txt" {
+		t.Fatal("a read-only directory should be synced with its files. got:", report, err)
+	}
+	if info, err := dest.Join("locked").Stat(); err != nil || info.Mode().Perm() != 0555 {
+		t.Errorf("the directory should get the source permissions once synced, got %v %v", info, err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	src := NewDir(PathHandler(t.TempDir()))
+	src.CreateFileWithString("a.txt", "alpha", true)
+	script := src.CreateFileWithString("run.sh", "#!/bin/sh", true)
+	script.SetPerm(0750)
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	script.SetModTime(mtime)
+	sub, _ := src.CreateSubdir("sub")
+	sub.CreateFileWithString("b.txt", "beta", true)
+	sub.CreateFileWithString("skip.log", "log", true)
+	PathHandler("../a.txt").Symlink(sub.Join("link"))
+
+	for _, name := range []string{"out.zip", "out.tar", "out.tar.gz"} {
+		archive := src.Join(name).File()
+		if err := src.ArchiveToWith(context.Background(), archive, ArchiveAuto, ArchiveOptions{Exclude: MustCompilePattern("*.log")}); err != nil {
+			t.Fatal(name, err)
+		}
+		dest := NewDir(PathHandler(t.TempDir()))
+		if err := archive.ExtractTo(dest); err != nil {
+			t.Fatal(name, err)
+		}
+		if content, _ := dest.Join("sub", "b.txt").File().ReadString(); content != "beta" {
+			t.Error(name, "should contain sub/b.txt. got:", content)
+		}
+		if dest.Join("sub", "skip.log").Exists() || dest.Join(name).Exists() {
+			t.Error(name, "should leave out excluded files and itself")
+		}
+		info, err := dest.Join("run.sh").Stat()
+		if err != nil || info.Mode().Perm() != 0750 || !info.ModTime().Equal(mtime) {
+			t.Error(name, "should keep mode and time. got:", info, err)
+		}
+		if target, err := dest.Join("sub", "link").Readlink(); err != nil || target != "../a.txt" {
+			t.Error(name, "should keep symlinks. got:", target, err)
+		}
+		// the format is detected from the content too
+		renamed := dest.Join("archive.bin").File()
+		data, _ := archive.Read()
+		renamed.Write(data)
+		if err := renamed.ExtractTo(NewDir(dest.Join("again"))); err != nil || !dest.Join("again", "a.txt").IsFile() {
+			t.Error(name, "should be detected by content. got:", err)
+		}
+	}
+}
+
+func TestExtractRejectsEscapes(t *testing.T) {
+	type entry struct{ name, link, body string }
+	for name, entries := range map[string][]entry{
+		"traversal":        {{name: "../evil.txt", body: "x"}},
+		"absolute":         {{name: "/tmp/evil.txt", body: "x"}},
+		"absolute link":    {{name: "link", link: "/etc"}},
+		"escaping link":    {{name: "link", link: "../../outside"}},
+		"write via link":   {{name: "dir/link", link: "../.."}, {name: "dir/link/evil.txt", body: "x"}},
+		"link through dot": {{name: "d", link: "."}, {name: "d/e", link: ".."}},
+	} {
+		parent := NewDir(PathHandler(t.TempDir()))
+		dest := NewDir(parent.Join("dest"))
+		var buf strings.Builder
+		tw := tar.NewWriter(&buf)
+		for _, e := range entries {
+			header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+			if e.link != "" {
+				header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, e.link, 0
+			}
+			tw.WriteHeader(header)
+			tw.Write([]byte(e.body))
+		}
+		tw.Close()
+		archive, _ := parent.CreateFileWithData("bad.tar", []byte(buf.String()), true)
+		var fsErr *Error
+		if err := archive.ExtractTo(dest); !errors.Is(err, ErrPathEscape) || !errors.As(err, &fsErr) {
+			t.Error(name, "should be rejected with an *Error wrapping ErrPathEscape. got:", err)
+		}
+		if parent.Join("evil.txt").Exists() {
+			t.Error(name, "wrote outside the destination")
+		}
+	}
+
+	var buf strings.Builder
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("../../zip-slip.txt")
+	w.Write([]byte("x"))
+	zw.Close()
+	parent := NewDir(PathHandler(t.TempDir()))
+	archive, _ := parent.CreateFileWithData("bad.zip", []byte(buf.String()), true)
+	if err := archive.ExtractTo(NewDir(parent.Join("a", "b"))); !errors.Is(err, ErrPathEscape) || parent.Join("zip-slip.txt").Exists() {
+		t.Error("zip slip should be rejected. got:", err)
+	}
+}
+
+func TestCompressedFile(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	logFile := dir.Join("app.log.gz").File()
+	gz := logFile.Compressed(CompressionAuto)
+	if err := gz.WriteString("first\nsecond\n"); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := logFile.Read(); len(raw) < 2 || raw[0] != 0x1f || raw[1] != 0x8b {
+		t.Error("the file should be gzip compressed on disk")
+	}
+	appendNext, err := gz.AppendIterative()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendNext([]byte("third\n"))
+	next, err := gz.IterateLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for line, err := next(); err == nil; line, err = next() {
+		lines = append(lines, line)
+	}
+	if strings.Join(lines, ",") != "first,second,third" {
+		t.Error("appended gzip members should read as one stream. got:", lines)
+	}
+
+	// without a known extension the format is detected from the content
+	renamed := dir.Join("dump.bin").File()
+	data, _ := logFile.Read()
+	renamed.Write(data)
+	if content, _ := renamed.Compressed(CompressionAuto).ReadString(); content != "first\nsecond\nthird\n" {
+		t.Error("gzip should be detected by magic bytes. got:", content)
+	}
+	if content, _ := dir.CreateFileWithString("plain.txt", "x^plain", true).Compressed(CompressionAuto).ReadString(); content != "x^plain" {
+		t.Error("plain files should be read as they are. got:", content)
+	}
+	if _, ok := any(gz).(interface{ AppendString(string, bool) error }); ok {
+		t.Error("raw File writers should not be promoted to CompressedFile")
+	}
+
+	zz := dir.Join("data.zz").File().Compressed(CompressionAuto)
+	zz.Write([]byte(strings.Repeat("zlib ", 100)))
+	for _, level := range []int{zlib.NoCompression, zlib.BestSpeed, zlib.DefaultCompression, zlib.BestCompression} {
+		var buf bytes.Buffer
+		w, _ := zlib.NewWriterLevel(&buf, level)
+		w.Write([]byte("deflated"))
+		w.Close()
+		raw := dir.CreateFileWithString("deflated.bin", "", true)
+		raw.Write(buf.Bytes())
+		if content, err := raw.Compressed(CompressionAuto).ReadString(); content != "deflated" {
+			t.Error("zlib should be detected by its header. got:", buf.Bytes()[:2], content, err)
+		}
+	}
+
+	read, closer, err := zz.ChunkReader(128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer()
+	total := 0
+	for chunk, err, done := read(); !done; chunk, err, done = read() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += len(chunk)
+	}
+	if total != 500 {
+		t.Error("chunks should add up to the decompressed size. got:", total)
+	}
+	if _, err := zz.AppendIterative(); !errors.Is(err, errors.ErrUnsupported) {
+		t.Error("zlib cannot be appended to. got:", err)
+	}
+	if err := dir.Join("x.bz2").File().Compressed(CompressionAuto).WriteString("x"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Error("bzip2 cannot be written. got:", err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type config struct {
+		Name  string   `json:"name"`
+		Ports []int    `json:"ports"`
+		Tags  []string `json:"tags,omitempty"`
+	}
+	dir := NewDir(PathHandler(t.TempDir()))
+	file := dir.Join("config.json").File()
+	if err := WriteJSON(file, config{Name: "api", Ports: []int{80, 443}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadJSON[config](file)
+	if err != nil || got.Name != "api" || len(got.Ports) != 2 {
+		t.Error("JSON should round trip. got:", got, err)
+	}
+	file.WriteString("{broken")
+	var fsErr *Error
+	if _, err := ReadJSON[config](file); !errors.As(err, &fsErr) || fsErr.Path != file.String() {
+		t.Error("invalid JSON should fail with an *Error naming the file. got:", err)
+	}
+
+	lines := dir.Join("events.jsonl").File()
+	for i := 0; i < 3; i++ {
+		if err := AppendJSONLine(lines, config{Name: fmt.Sprint("event", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var names []string
+	for record, err := range IterateJSONLines[config](lines) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, record.Name)
+	}
+	if strings.Join(names, ",") != "event0,event1,event2" {
+		t.Error("JSON lines should be read in order. got:", names)
+	}
+	WriteJSONLines(lines, func(yield func(config) bool) {
+		yield(config{Name: "only"})
+	})
+	lines.AppendString("\nnot json", false)
+	count := 0
+	var lastErr error
+	for _, err := range IterateJSONLines[config](lines) {
+		count++
+		lastErr = err
+	}
+	if count != 2 || lastErr == nil || !strings.Contains(lastErr.Error(), "line 3") {
+		t.Error("a bad line should stop the iteration with its line number. got:", count, lastErr)
+	}
+
+	// a record failing to encode partway leaves the previous content
+	before, _ := lines.ReadString()
+	err = WriteJSONLines(lines, slices.Values([]any{config{Name: "first"}, make(chan int)}))
+	if after, _ := lines.ReadString(); err == nil || after != before {
+		t.Errorf("a failed write should keep the file, got %q %v", after, err)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	type user struct {
+		ID      int     `csv:"id"`
+		Name    string  `csv:"name"`
+		Admin   bool    `csv:"is_admin"`
+		Score   float64 `csv:"score"`
+		Ignored string  `csv:"-"`
+	}
+	dir := NewDir(PathHandler(t.TempDir()))
+	users := []user{{1, "ana", true, 9.5, "x"}, {2, "bo, jr", false, 7, "y"}}
+	for _, name := range []string{"users.csv", "users.tsv"} {
+		file := dir.Join(name).File()
+		err := WriteCSVRecords(file, func(yield func(user) bool) {
+			for _, u := range users {
+				if !yield(u) {
+					return
+				}
+			}
+		}, CSVOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var read []user
+		for u, err := range IterateCSVRecords[user](file, CSVOptions{}) {
+			if err != nil {
+				t.Fatal(name, err)
+			}
+			read = append(read, u)
+		}
+		if len(read) != 2 || read[1].Name != "bo, jr" || !read[0].Admin || read[0].Score != 9.5 || read[0].Ignored != "" {
+			t.Error(name, "records should round trip. got:", read)
+		}
+	}
+	if header, _ := dir.Join("users.tsv").File().ReadString(); !strings.HasPrefix(header, "id\tname\tis_admin\tscore\n") {
+		t.Error(".tsv files should be tab separated. got:", header)
+	}
+
+	file := dir.CreateFileWithString("rows.csv", "Name,ID,extra\nana,one,x\n", true)
+	var rows int
+	for range IterateCSV(file, CSVOptions{}) {
+		rows++
+	}
+	if rows != 2 {
+		t.Error("every row should be read. got:", rows)
+	}
+	for _, err := range IterateCSVRecords[user](file, CSVOptions{}) {
+		if err == nil || !strings.Contains(err.Error(), `column "id"`) {
+			t.Error("a bad value should name its column. got:", err)
+		}
+	}
+	// fields of embedded struct pointers are allocated when reading and
+	// written empty when the pointer is nil
+	type Person struct {
+		Name string `csv:"name"`
+	}
+	type account struct {
+		*Person
+		Plan string `csv:"plan"`
+	}
+	accounts := dir.Join("accounts.csv").File()
+	err := WriteCSVRecords(accounts, slices.Values([]account{{&Person{"ana"}, "pro"}, {nil, "free"}}), CSVOptions{})
+	if content, _ := accounts.ReadString(); err != nil || content != "name,plan\nana,pro\n,free\n" {
+		t.Error("a nil embedded pointer should be written as empty fields. got:", content, err)
+	}
+	var read []account
+	for a, err := range IterateCSVRecords[account](accounts, CSVOptions{}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		read = append(read, a)
+	}
+	if len(read) != 2 || read[0].Person == nil || read[0].Name != "ana" || read[1].Plan != "free" {
+		t.Error("embedded pointers should be allocated when reading. got:", read)
+	}
+
+	// a record failing to encode leaves the previous content
+	type broken struct {
+		Name  string
+		Extra map[string]int
+	}
+	err = WriteCSVRecords(accounts, slices.Values([]broken{{Name: "x"}}), CSVOptions{})
+	if content, _ := accounts.ReadString(); err == nil || content != "name,plan\nana,pro\n,free\n" {
+		t.Error("a failed write should keep the file. got:", content, err)
+	}
+	if entries, _ := dir.All(); slices.ContainsFunc(entries, func(p PathHandler) bool { return strings.Contains(p.Name(), ".tmp-") }) {
+		t.Error("a failed write should not leave a temporary file. got:", entries)
+	}
+
+	// nil pointers are written empty and pointer receiver MarshalText is used
+	type event struct {
+		At    *time.Time `csv:"at"`
+		Count *int       `csv:"count"`
+		Level csvLevel   `csv:"level"`
+	}
+	at, count := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), 3
+	events := dir.Join("events.csv").File()
+	err = WriteCSVRecords(events, slices.Values([]event{{nil, nil, 1}, {&at, &count, 2}}), CSVOptions{})
+	if content, _ := events.ReadString(); err != nil || content != "at,count,level\n,,level-1\n2024-05-06T07:08:09Z,3,level-2\n" {
+		t.Errorf("nil pointers should be written empty, got %q %v", content, err)
+	}
+}
+
+// csvLevel formats itself through a pointer receiver.
+type csvLevel int
+
+func (l *csvLevel) MarshalText() ([]byte, error) {
+	return []byte("level-" + strconv.Itoa(int(*l))), nil
+}
+
+func TestTrash(t *testing.T) {
+	base := NewDir(PathHandler(t.TempDir()))
+	trash := NewTrash(NewDir(base.Join("Trash")))
+	work, _ := base.CreateSubdir("work")
+	file := work.CreateFileWithString("notes 100%.txt", "keep me", true)
+	sub, _ := work.CreateSubdir("sub")
+	sub.CreateFileWithString("a.txt", "a", true)
+
+	item, err := file.Trash(trash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Exists() || !item.Path().IsFile() {
+		t.Error("the file should be moved into the trash")
+	}
+	info, _ := base.Join("Trash", "info", "notes 100%.txt.trashinfo").File().ReadString()
+	if !strings.Contains(info, "[Trash Info]\nPath=") || !strings.Contains(info, "notes%20100%25.txt") || !strings.Contains(info, "DeletionDate=") {
+		t.Error("the info file should follow the freedesktop spec. got:", info)
+	}
+	work.CreateFileWithString("notes 100%.txt", "second", true)
+	second, err := trash.Put(file.PathHandler)
+	if err != nil || second.Name == item.Name {
+		t.Error("equally named entries should get unique names. got:", second.Name, err)
+	}
+	for _, name := range []string{"../../work", "../Trash", ".", "", "sub/a.txt", base.String()} {
+		if err := trash.Delete(TrashItem{Name: name}); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("Delete of %q should fail with ErrPathEscape, got %v", name, err)
+		}
+		if err := trash.RestoreTo(TrashItem{Name: name}, base.Join("restored")); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("RestoreTo of %q should fail with ErrPathEscape, got %v", name, err)
+		}
+	}
+	if !work.Exists() || !base.Join("Trash", "files").Exists() {
+		t.Fatal("crafted names should not delete anything")
+	}
+	if _, err := trash.Put(sub.PathHandler); err != nil {
+		t.Fatal(err)
+	}
+	items, err := trash.List()
+	if err != nil || len(items) != 3 {
+		t.Fatal("all entries should be listed. got:", items, err)
+	}
+	if items[0].OriginalPath != file.PathHandler || items[0].DeletedAt.IsZero() {
+		t.Error("the metadata should be read back. got:", items[0])
+	}
+
+	if err := trash.Restore(item); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := file.ReadString(); content != "keep me" {
+		t.Error("restore should bring the file back. got:", content)
+	}
+	if err := trash.Restore(second); !errors.Is(err, os.ErrExist) {
+		t.Error("restore should not overwrite. got:", err)
+	}
+
+	// age one entry and purge only that one
+	old := time.Now().Add(-48 * time.Hour).Format("2006-01-02T15:04:05")
+	infoFile := base.Join("Trash", "info", second.Name+".trashinfo").File()
+	content, _ := infoFile.ReadString()
+	infoFile.WriteString(content[:strings.Index(content, "DeletionDate=")] + "DeletionDate=" + old + "\n")
+	purged, err := trash.Purge(24 * time.Hour)
+	if err != nil || len(purged) != 1 || purged[0].Name != second.Name || second.Path().Exists() {
+		t.Error("purge should remove old entries only. got:", purged, err)
+	}
+	if items, _ := trash.List(); len(items) != 1 || items[0].OriginalPath != sub.PathHandler {
+		t.Error("the directory should still be in the trash. got:", items)
+	}
+	if _, err := trash.Put(base.Join("Trash", "files")); err == nil {
+		t.Error("the trash should not be trashed")
+	}
+
+	// paths on another device or backend are moved by a verified copy
+	mem := PathHandler(string(os.PathSeparator) + "easyfs-trash-test")
+	Mount(mem, NewMemFileSystem())
+	defer Unmount(mem)
+	mem.Dir().CreateIfNotExist()
+	remote := mem.Dir().CreateFileWithString("remote.txt", "far away", true)
+	item, err = trash.Put(remote.PathHandler)
+	if err != nil || remote.Exists() || !item.Path().IsFile() {
+		t.Fatal("a path on another backend should be trashed. got:", err)
+	}
+	if err := trash.Restore(item); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := remote.ReadString(); content != "far away" || item.Path().Exists() {
+		t.Error("a path should be restored to another backend. got:", content)
+	}
+}
+
+func TestTrashRestoreRace(t *testing.T) {
+	root := PathHandler(string(os.PathSeparator) + "easyfs-trash-race-test")
+	fsys := &renameHookFS{MemFileSystem: NewMemFileSystem()}
+	Mount(root, fsys)
+	defer Unmount(root)
+	root.Dir().CreateIfNotExist()
+	trash := NewTrash(root.Join("Trash").Dir())
+	file := root.Dir().CreateFileWithString("notes.txt", "trashed", true)
+	dir, _ := root.Dir().CreateSubdir("project")
+	dir.CreateFileWithString("a.txt", "a", true)
+	fileItem, err := trash.Put(file.PathHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirItem, err := trash.Put(dir.PathHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// something appears at the destination while the entry is on its way
+	for _, item := range []TrashItem{fileItem, dirItem} {
+		fsys.hook = func() {
+			item.OriginalPath.Parent().CreateFileWithString(item.OriginalPath.Name(), "new", true)
+		}
+		if err := trash.Restore(item); !errors.Is(err, os.ErrExist) {
+			t.Errorf("restoring %s should fail with ErrExist, got %v", item.Name, err)
+		}
+		if content, _ := item.OriginalPath.File().ReadString(); content != "new" || !item.Path().Exists() {
+			t.Errorf("%s should stay in the trash and leave the new file alone, got %q", item.Name, content)
+		}
+		item.OriginalPath.File().Delete()
+	}
+}
+
+// renameHookFS runs hook once before the next rename.
+type renameHookFS struct {
+	*MemFileSystem
+	hook func()
+}
+
+func (r *renameHookFS) Rename(oldname, newname string) error {
+	if hook := r.hook; hook != nil {
+		r.hook = nil
+		hook()
+	}
+	return r.MemFileSystem.Rename(oldname, newname)
+}
+
+func TestTx(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	config := dir.CreateFileWithString("config.txt", "old config", true)
+	doomed, _ := dir.CreateSubdir("doomed")
+	doomed.CreateFileWithString("data.txt", "data", true)
+	dir.CreateFileWithString("current", "v1", true)
+	dir.CreateFileWithString("next", "v2", true)
+	snapshot := func() string {
+		var b strings.Builder
+		dir.Walk(func(entry WalkEntry, err error) error {
+			content, _ := entry.Path.File().ReadString()
+			b.WriteString(dir.slashRel(entry.Path) + "=" + content + ";")
+			return nil
+		})
+		return b.String()
+	}
+	before := snapshot()
+
+	run := func(tx *Tx) error {
+		sub, err := tx.CreateSubdir(dir, "a/b")
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateFileWithData(sub, "new.txt", []byte("new"), false); err != nil {
+			return err
+		}
+		if _, err := tx.CreateFileWithData(dir, "config.txt", []byte("new config"), true); err != nil {
+			return err
+		}
+		if _, err := tx.Rename(dir.Join("next"), "current"); err != nil {
+			return err
+		}
+		if _, err := tx.Move(dir.Join("config.txt"), sub); err != nil {
+			return err
+		}
+		return tx.Delete(doomed.PathHandler)
+	}
+
+	failure := errors.New("boom")
+	err := Transaction(func(tx *Tx) error {
+		if err := run(tx); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Error("the error of fn should be returned. got:", err)
+	}
+	if after := snapshot(); after != before {
+		t.Error("rollback should restore everything.\ngot: ", after, "\nwant:", before)
+	}
+
+	tx := NewTx()
+	if err := run(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	want := "a=;a/b=;a/b/config.txt=new config;a/b/new.txt=new;current=v2;"
+	if after := snapshot(); after != want {
+		t.Error("commit should keep the changes and remove backups.\ngot: ", after, "\nwant:", want)
+	}
+	if err := tx.Rollback(); err != nil || !config.Parent().Join("a", "b", "config.txt").Exists() {
+		t.Error("rollback after commit should do nothing. got:", err)
+	}
+	if _, err := tx.CreateSubdir(dir, "late"); !errors.Is(err, ErrTxDone) {
+		t.Error("a finished transaction should refuse operations. got:", err)
+	}
+	if _, err := NewTx().CreateFileWithData(dir, "current", nil, false); !errors.Is(err, os.ErrExist) {
+		t.Error("existing files should not be overwritten without overwrite. got:", err)
+	}
+
+	// writing through a link replaces its target, which rollback restores
+	linked := NewDir(PathHandler(t.TempDir())).CreateFileWithString("target.txt", "old target", true)
+	linked.PathHandler.Symlink(dir.Join("link"))
+	err = Transaction(func(tx *Tx) error {
+		if _, err := tx.CreateFileWithData(dir, "link", []byte("new target"), true); err != nil {
+			return err
+		}
+		if content, _ := linked.ReadString(); content != "new target" {
+			t.Error("the target of the link should be written. got:", content)
+		}
+		return failure
+	})
+	if content, _ := linked.ReadString(); !errors.Is(err, failure) || content != "old target" {
+		t.Error("rollback should restore the target of a link. got:", content, err)
+	}
+	if !dir.Join("link").IsSymlink() {
+		t.Error("the link should be kept")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	cache, _ := dir.CreateSubdir("cache")
+	cache.CreateFileWithString("a.tmp", "a", true)
+	nested, _ := cache.CreateSubdir("nested")
+	nested.CreateFileWithString("b.tmp", "b", true)
+	src := dir.CreateFileWithString("report.txt", "report", true)
+
+	plan, err := DryRun(func() error {
+		if err := cache.Clear(true); err != nil {
+			return err
+		}
+		if !cache.IsEmpty() {
+			return errors.New("the dry run should look cleared")
+		}
+		if _, err := src.Copy(NewDir(dir.Join("backup"))); err != nil {
+			return err
+		}
+		moved := src.PathHandler
+		return moved.Move(dir.Join("cache"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, op := range plan {
+		got = append(got, op.Op+" "+dir.slashRel(PathHandler(op.Path)))
+	}
+	want := []string{"remove cache/a.tmp", "remove cache/nested/b.tmp", "remove cache/nested", "mkdir backup", "create backup/report.txt", "rename report.txt"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Error("the plan should list every change in order.\ngot: ", got, "\nwant:", want)
+	}
+	if plan[4].Size != 6 {
+		t.Error("writes should be counted. got:", plan[4])
+	}
+	if !cache.Join("nested", "b.tmp").Exists() || dir.Join("backup").Exists() || !src.Exists() {
+		t.Error("a dry run should not touch the disk")
+	}
+
+	// the backend can also be used directly
+	dry := NewDryRunFileSystem(NewMemFileSystem())
+	root := PathHandler(string(os.PathSeparator) + "easyfs-dry-test")
+	Mount(root, dry)
+	defer Unmount(root)
+	root.Dir().CreateIfNotExist()
+	root.Dir().CreateFileWithString("x.txt", "x", true)
+	if ops := dry.Plan(); len(ops) != 3 || ops[0].String() != "mkdir "+root.String()+" 0777" || ops[2].String() != "write "+root.Join("x.txt").String()+" (1 bytes)" {
+		t.Error("the plan should be readable. got:", ops)
+	}
+}
+
+func TestCopyProgress(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	src, _ := dir.CreateSubdir("src")
+	src.CreateFileWithString("a.txt", strings.Repeat("a", 1000), true)
+	sub, _ := src.CreateSubdir("sub")
+	sub.CreateFileWithString("b.txt", strings.Repeat("b", 500), true)
+
+	var reports []CopyProgress
+	opts := CopyOptions{PreScan: true, ProgressInterval: time.Nanosecond, Progress: func(p CopyProgress) {
+		reports = append(reports, p)
+	}}
+	if err := src.CopyWith(context.Background(), dir.Join("dest"), opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) < 2 {
+		t.Fatalf("expected several reports, got %d", len(reports))
+	}
+	last := reports[len(reports)-1]
+	if !last.Done || last.FilesCopied != 2 || last.FilesTotal != 2 || last.BytesCopied != 1500 || last.BytesTotal != 1500 {
+		t.Errorf("unexpected final report %+v", last)
+	}
+	for _, p := range reports[:len(reports)-1] {
+		if p.Done {
+			t.Error("only the last report should be done")
+		}
+	}
+
+	reports = nil
+	copied, err := src.Join("a.txt").File().CopyWith(context.Background(), dir.Join("single").Dir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last = reports[len(reports)-1]
+	if !copied.Exists() || !last.Done || last.FilesTotal != 1 || last.BytesTotal != 1000 || last.BytesCopied != 1000 || last.CurrentPath != src.Join("a.txt") {
+		t.Errorf("unexpected final report %+v", last)
+	}
+}
+
+func TestParallelCopy(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	src, _ := dir.CreateSubdir("src")
+	for i := range 20 {
+		sub, _ := src.CreateSubdir(fmt.Sprintf("d%d/e%d", i%3, i%2))
+		sub.CreateFileWithString(fmt.Sprintf("f%d.txt", i), strings.Repeat("x", i), true)
+	}
+	if err := src.CopyWith(context.Background(), dir.Join("dest"), CopyOptions{Workers: 4}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		content, err := dir.Join("dest", fmt.Sprintf("d%d/e%d/f%d.txt", i%3, i%2, i)).File().ReadString()
+		if err != nil || content != strings.Repeat("x", i) {
+			t.Errorf("file %d was not copied: %q, %v", i, content, err)
+		}
+	}
+
+	// directories in the way of two files make both copies fail
+	conflict, _ := dir.CreateSubdir("conflict")
+	conflict.CreateSubdir("d0/e0/f0.txt")
+	conflict.CreateSubdir("d1/e1/f1.txt")
+	err := src.CopyWith(context.Background(), conflict.PathHandler, CopyOptions{Workers: 4, ContinueOnError: true})
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 2 {
+		t.Fatalf("expected two joined errors, got %v", err)
+	}
+	if !conflict.Join("d2/e0/f2.txt").Exists() || !conflict.Join("d1/e1/f19.txt").Exists() {
+		t.Error("ContinueOnError should copy the other files")
+	}
+	if err := src.CopyWith(context.Background(), conflict.PathHandler, CopyOptions{Workers: 4}); err == nil {
+		t.Error("expected the copy to fail")
+	}
+}
+
+func TestCopyMetadata(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	src, _ := dir.CreateSubdir("src")
+	file := src.CreateFileWithString("script.sh", "#!/bin/sh", true)
+	file.SetPerm(0750)
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	file.SetModTime(old)
+	file.PathHandler.Symlink(src.Join("link"))
+	withXattr := OSFileSystem{}.SetXattr(file.String(), "user.easyfs", []byte("kept")) == nil
+	sub, _ := src.CreateSubdir("sub")
+	sub.CreateFileWithString("data.txt", "data", true)
+	sub.SetPerm(0700)
+	sub.SetModTime(old)
+
+	opts := CopyOptions{PreserveMode: true, PreserveTimes: true, PreserveOwner: true, PreserveXattrs: true, CopySymlinks: true}
+	dest := dir.Join("dest").Dir()
+	if err := src.CopyWith(context.Background(), dest.PathHandler, opts); err != nil {
+		t.Fatal(err)
+	}
+	info, err := dest.Join("script.sh").Stat()
+	if err != nil || info.Mode().Perm() != 0750 || !info.ModTime().Equal(old) {
+		t.Errorf("file metadata was not preserved: %v %v", info, err)
+	}
+	if info, err := dest.Join("sub").Stat(); err != nil || info.Mode().Perm() != 0700 || !info.ModTime().Equal(old) {
+		t.Errorf("directory metadata was not preserved: %v %v", info, err)
+	}
+	if !dest.Join("link").IsSymlink() {
+		t.Error("the symbolic link should be copied as a link")
+	} else if target, _ := dest.Join("link").Readlink(); target != file.PathHandler {
+		t.Errorf("link points to %s", target)
+	}
+	if withXattr {
+		if data, err := (OSFileSystem{}).GetXattr(dest.Join("script.sh").String(), "user.easyfs"); err != nil || string(data) != "kept" {
+			t.Errorf("extended attribute was not preserved: %q %v", data, err)
+		}
+	}
+
+	plain := dir.Join("plain").Dir()
+	if err := src.CopyWith(context.Background(), plain.PathHandler, CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := plain.Join("script.sh").Stat(); err != nil || plain.Join("link").IsSymlink() || info.ModTime().Equal(old) {
+		t.Error("a plain copy should follow links and not keep times")
+	}
+}
+
+// xattrFS wraps the OS backend, listing the given attributes for every file
+// and failing to set any. Reading one not named "user.easyfs-gone" succeeds.
+type xattrFS struct {
+	OSFileSystem
+	names []string
+}
+
+func (x xattrFS) ListXattr(name string) ([]string, error) { return x.names, nil }
+
+func (x xattrFS) GetXattr(name, attr string) ([]byte, error) {
+	if attr == "user.easyfs-gone" {
+		return x.OSFileSystem.GetXattr(name, attr)
+	}
+	return []byte("value"), nil
+}
+
+func (xattrFS) SetXattr(name, attr string, data []byte) error {
+	return &os.PathError{Op: "setxattr", Path: name, Err: errors.New("attribute store full")}
+}
+
+func TestCopyMetadataFailure(t *testing.T) {
+	root := PathHandler(t.TempDir())
+	fsys := &xattrFS{}
+	Mount(root, fsys)
+	defer Unmount(root)
+	dir := root.Dir()
+	file := dir.CreateFileWithString("data.txt", "new", true)
+	dest, _ := dir.CreateSubdir("dest")
+	dest.CreateFileWithString("data.txt", "old", true)
+	opts := CopyOptions{PreserveXattrs: true}
+
+	// an attribute listed but gone when read is skipped
+	if _, err := (OSFileSystem{}).GetXattr(file.String(), "user.easyfs-gone"); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		fsys.names = []string{"user.easyfs-gone"}
+		if _, err := file.CopyWith(context.Background(), dest, opts); err != nil {
+			t.Errorf("a vanished attribute should be skipped: %v", err)
+		}
+	}
+
+	// the data was copied fine, so a metadata failure keeps the copy
+	fsys.names = []string{"user.easyfs"}
+	dest.CreateFileWithString("data.txt", "old", true)
+	copied, err := file.CopyWith(context.Background(), dest, opts)
+	if err == nil || !strings.Contains(err.Error(), "attribute store full") {
+		t.Errorf("the metadata failure should be reported: %v", err)
+	}
+	if strings.Contains(fmt.Sprint(err), ".tmp-") {
+		t.Errorf("the error should not name the staged copy: %v", err)
+	}
+	if copied.PathHandler != dest.Join("data.txt") {
+		t.Errorf("the copy should be returned with the error, got %q", copied)
+	}
+	if content, _ := dest.Join("data.txt").File().ReadString(); content != "new" {
+		t.Errorf("the copy should be kept, got %q", content)
+	}
+	if entries, _ := dest.All(); len(entries) != 1 {
+		t.Errorf("no temporary file should be left: %v", entries)
+	}
+
+}
+
+func TestConflictPolicies(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	src, _ := dir.CreateSubdir("src")
+	dest, _ := dir.CreateSubdir("dest")
+	file := src.CreateFileWithString("report.pdf", "new", true)
+	existing := dest.CreateFileWithString("report.pdf", "old", true)
+	read := func(p PathHandler) string {
+		content, _ := p.File().ReadString()
+		return content
+	}
+
+	if _, err := file.CopyWith(context.Background(), dest, CopyOptions{Conflict: ConflictFail}); !errors.Is(err, os.ErrExist) {
+		t.Errorf("ConflictFail should fail with ErrExist, got %v", err)
+	}
+	if _, err := file.CopyWith(context.Background(), dest, CopyOptions{Conflict: ConflictSkip}); err != nil || read(existing.PathHandler) != "old" {
+		t.Error("ConflictSkip should keep the destination", err)
+	}
+	existing.SetModTime(time.Now().Add(time.Hour))
+	if _, err := file.CopyWith(context.Background(), dest, CopyOptions{Conflict: ConflictOverwriteIfNewer}); err != nil || read(existing.PathHandler) != "old" {
+		t.Error("ConflictOverwriteIfNewer should keep a newer destination", err)
+	}
+	copied, err := file.CopyWith(context.Background(), dest, CopyOptions{Conflict: ConflictKeepBoth})
+	if err != nil || copied.Name() != "report (1).pdf" || read(copied.PathHandler) != "new" {
+		t.Errorf("ConflictKeepBoth should pick a new name, got %s %v", copied, err)
+	}
+	if err := src.CopyWith(context.Background(), dest.PathHandler, CopyOptions{OnConflict: func(src, dest PathHandler) ConflictPolicy {
+		return ConflictOverwrite
+	}}); err != nil || read(existing.PathHandler) != "new" {
+		t.Error("OnConflict should decide to overwrite", err)
+	}
+
+	// a failed overwrite leaves the existing destination as it was
+	big := src.CreateFileWithString("big.bin", strings.Repeat("x", 1<<20), true)
+	kept := dest.CreateFileWithString("big.bin", "keep me", true)
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = big.CopyWith(ctx, dest, CopyOptions{ProgressInterval: time.Nanosecond, Progress: func(p CopyProgress) {
+		if p.BytesCopied > 0 {
+			cancel()
+		}
+	}})
+	if !errors.Is(err, context.Canceled) || read(kept.PathHandler) != "keep me" {
+		t.Error("a cancelled copy should keep the destination. got:", len(read(kept.PathHandler)), "bytes", err)
+	}
+	if all, _ := dest.All(); len(all) != 3 {
+		t.Error("a cancelled copy should leave no temporary file. got:", all)
+	}
+
+	moved := dest.Join("report (1).pdf")
+	if err := moved.RenameWith("report.pdf", MoveOptions{Conflict: ConflictSkip}); err != nil || moved.Name() != "report (1).pdf" {
+		t.Error("a skipped rename should leave the path alone", err)
+	}
+	if err := moved.RenameWith("report.pdf", MoveOptions{Conflict: ConflictKeepBoth}); err != nil || moved.Name() != "report (2).pdf" || !moved.Exists() {
+		t.Error("renaming to keep both should pick a free name", moved, err)
+	}
+	other, _ := dir.CreateSubdir("other")
+	other.CreateSubdir("report (2).pdf/nested")
+	target := other.Join("report (2).pdf")
+	if err := moved.MoveWith(other.PathHandler, MoveOptions{}); err != nil || moved != target || read(moved) != "new" {
+		t.Error("overwriting move should replace the directory", moved, err)
+	}
+
+	// a moved directory replaces an existing one instead of being merged
+	// into it, unlike a copy
+	srcDir, _ := dir.CreateSubdir("move/assets")
+	srcDir.CreateFileWithString("a.txt", "a", true)
+	destDir, _ := other.CreateSubdir("assets")
+	destDir.CreateFileWithString("b.txt", "b", true)
+	if err := srcDir.MoveWith(other.PathHandler, MoveOptions{}); err != nil || srcDir.PathHandler != destDir.PathHandler {
+		t.Fatal("overwriting move of a directory failed", err)
+	}
+	if !destDir.HasFile("a.txt") || destDir.HasFile("b.txt") {
+		t.Error("overwriting move should replace the directory as a whole")
+	}
+}
+
+func TestCrossDeviceMove(t *testing.T) {
+	root := PathHandler(string(os.PathSeparator) + "easyfs-move-test")
+	Mount(root, NewMemFileSystem())
+	defer Unmount(root)
+	mem := root.Dir()
+	mem.CreateIfNotExist()
+
+	dir := NewDir(PathHandler(t.TempDir()))
+	src, _ := dir.CreateSubdir("project")
+	sub, _ := src.CreateSubdir("sub")
+	file := sub.CreateFileWithString("data.txt", "data", true)
+	file.SetPerm(0600)
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	file.SetModTime(old)
+	PathHandler("data.txt").Symlink(sub.Join("link"))
+
+	moved := src.PathHandler
+	if err := moved.Move(mem.PathHandler); err != nil {
+		t.Fatal(err)
+	}
+	if moved != mem.Join("project") || src.Exists() {
+		t.Errorf("the source should be gone after moving to %s", moved)
+	}
+	info, err := moved.Join("sub", "data.txt").Stat()
+	if err != nil || info.Mode().Perm() != 0600 || !info.ModTime().Equal(old) {
+		t.Errorf("the moved file should keep its metadata: %v %v", info, err)
+	}
+	if target, err := moved.Join("sub", "link").Readlink(); err != nil || target != "data.txt" {
+		t.Errorf("the link should be moved as a link: %q %v", target, err)
+	}
+	if entries, _ := mem.FileSystem().ReadDir(mem.String()); len(entries) != 1 {
+		t.Error("the staging directory should be removed")
+	}
+
+	// a single file replaces an existing one, as rename does
+	dir.CreateFileWithString("data.txt", "new", true)
+	back := dir.Join("data.txt")
+	if err := back.Move(moved.Join("sub")); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := moved.Join("sub", "data.txt").File().ReadString(); content != "new" || dir.Join("data.txt").Exists() {
+		t.Error("moving a file across backends should replace the destination")
+	}
+
+	// the copy reaches stable storage before the source is removed
+	syncRoot := PathHandler(string(os.PathSeparator) + "easyfs-move-sync-test")
+	recorder := &syncRecordingFS{MemFileSystem: NewMemFileSystem(), synced: map[string]bool{}}
+	Mount(syncRoot, recorder)
+	defer Unmount(syncRoot)
+	syncRoot.Dir().CreateIfNotExist()
+	src, _ = dir.CreateSubdir("synced")
+	src.CreateFileWithString("a.txt", "a", true)
+	moved = src.PathHandler
+	if err := moved.Move(syncRoot); err != nil {
+		t.Fatal(err)
+	}
+	// the staged file and directory, and the destination after the rename
+	for _, name := range []string{"a.txt", "synced", syncRoot.Name()} {
+		if !recorder.synced[name] {
+			t.Errorf("%q should be synced by the move, synced: %v", name, recorder.synced)
+		}
+	}
+}
+
+// syncRecordingFS records the base names of the files synced through it.
+type syncRecordingFS struct {
+	*MemFileSystem
+	mu     sync.Mutex
+	synced map[string]bool
+}
+
+func (r *syncRecordingFS) OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error) {
+	h, err := r.MemFileSystem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return syncRecordingHandle{h, r, name}, nil
+}
+
+type syncRecordingHandle struct {
+	FileHandle
+	fs   *syncRecordingFS
+	name string
+}
+
+func (h syncRecordingHandle) Sync() error {
+	h.fs.mu.Lock()
+	h.fs.synced[filepath.Base(h.name)] = true
+	h.fs.mu.Unlock()
+	return h.FileHandle.Sync()
+}
+
+func TestRoot(t *testing.T) {
+	parent := NewDir(PathHandler(t.TempDir()))
+	secret := parent.CreateFileWithString("secret.txt", "secret", true)
+	dir, _ := parent.CreateSubdir("jail")
+	dir.CreateSubdir("inside")
+	secret.PathHandler.Symlink(dir.Join("absolute"))
+	PathHandler("../secret.txt").Symlink(dir.Join("relative"))
+	PathHandler("..").Symlink(dir.Join("inside", "up"))
+	PathHandler("inside").Symlink(dir.Join("alias"))
+
+	root, err := OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"../secret.txt", "inside/../../secret.txt", secret.String(), "absolute", "relative", "inside/up/../secret.txt", "alias/up/../secret.txt"} {
+		if _, err := root.Join(name); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("Join(%q) should fail with ErrPathEscape, got %v", name, err)
+		}
+		if _, err := root.CreateFileWithData(name, []byte("x"), true); !errors.Is(err, ErrPathEscape) {
+			t.Errorf("CreateFileWithData(%q) should fail with ErrPathEscape, got %v", name, err)
+		}
+	}
+	if content, _ := secret.ReadString(); content != "secret" {
+		t.Fatal("a file outside the root was overwritten")
+	}
+	if err := root.DeleteSubDir("inside/up", true); err != nil || !parent.Join("jail").Exists() || !dir.Join("inside").Exists() {
+		t.Error("deleting a link should not delete its target", err)
+	}
+
+	p, err := root.Join("alias", "file.txt")
+	if err != nil || p != dir.Join("inside", "file.txt") {
+		t.Errorf("links inside the root should resolve, got %s %v", p, err)
+	}
+	if _, err := root.CreateFileWithData("alias/file.txt", []byte("ok"), false); err != nil {
+		t.Error(err)
+	}
+	if _, err := root.CreateFileWithData("alias/file.txt", []byte("clobbered"), false); !errors.Is(err, ErrExist) {
+		t.Errorf("creating an existing file without overwrite should fail with ErrExist, got %v", err)
+	}
+	if content, _ := dir.Join("inside", "file.txt").File().ReadString(); content != "ok" {
+		t.Errorf("an existing file should be kept without overwrite, got %q", content)
+	}
+	PathHandler(".").Symlink(dir.Join("self"))
+	for _, name := range []string{".", "", "inside/..", "self"} {
+		if _, err := root.CreateFile(name, true); !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("CreateFile(%q) should fail with os.ErrInvalid, got %v", name, err)
+		}
+		if _, err := root.CreateFileWithData(name, []byte("x"), true); !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("CreateFileWithData(%q) should fail with os.ErrInvalid, got %v", name, err)
+		}
+		if _, err := root.CreateSubdir(name); !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("CreateSubdir(%q) should fail with os.ErrInvalid, got %v", name, err)
+		}
+		if name == "self" {
+			// deleting the link itself is fine
+			continue
+		}
+		if err := root.DeleteSubFile(name); !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("DeleteSubFile(%q) should fail with os.ErrInvalid, got %v", name, err)
+		}
+		if err := root.DeleteSubDir(name, true); !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("DeleteSubDir(%q) should fail with os.ErrInvalid, got %v", name, err)
+		}
+	}
+	if info, err := dir.Stat(); err != nil || !info.IsDir() {
+		t.Fatal("the root should be left alone", err)
+	}
+	if err := root.DeleteSubFile("self"); err != nil || !dir.Exists() {
+		t.Error("deleting a link to the root should only delete the link", err)
+	}
+	if sub, err := root.CreateSubdir("a/b"); err != nil || !sub.Exists() {
+		t.Error(err)
+	}
+	found, err := root.Find("*", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range found {
+		if name := p.Name(); name == "absolute" || name == "relative" {
+			t.Errorf("Find should leave out %s", p)
+		}
+	}
+	if len(found) != 5 {
+		t.Errorf("expected alias, a, a/b, inside and inside/file.txt, got %v", found)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	dir := NewDir(PathHandler(t.TempDir()))
+	sub, _ := dir.CreateSubdir("sub")
+	sub.CreateFileWithString("a.txt", "a", true)
+
+	_, err := sub.PathHandler.File().Read()
+	var fsErr *Error
+	if !errors.As(err, &fsErr) || fsErr.Op != "read" || fsErr.Path != sub.String() || !errors.Is(err, ErrIsDirectory) || errors.Is(err, ErrNotFound) {
+		t.Errorf("reading a directory should fail with ErrIsDirectory, got %v", err)
+	}
+	if _, err := dir.Join("missing.txt").File().Read(); !errors.Is(err, ErrNotFound) || !errors.Is(err, os.ErrNotExist) || KindOf(err) != ErrNotFound {
+		t.Errorf("reading a missing file should fail with ErrNotFound, got %v", err)
+	}
+	if _, err := sub.PathHandler.File().Copy(dir); KindOf(err) != ErrIsDirectory {
+		t.Errorf("copying a directory as a file should fail with ErrIsDirectory, got %v", err)
+	}
+	if err := sub.PathHandler.File().Write([]byte("data")); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("writing a directory should fail with ErrIsDirectory, got %v", err)
+	}
+	if err := sub.PathHandler.File().AppendString("data", true); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("appending to a directory should fail with ErrIsDirectory, got %v", err)
+	}
+	if err := sub.Join("a.txt").Dir().CreateIfNotExist(); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("creating a directory over a file should fail with ErrNotDirectory, got %v", err)
+	}
+	if _, err := sub.CreateSubdir(filepath.Join("a.txt", "b")); !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("creating a directory below a file should fail with ErrNotDirectory, got %v", err)
+	}
+	_, err = dir.FileSystem().OpenFile(sub.Join("a.txt", "b").String(), os.O_RDONLY, 0)
+	if KindOf(err) != ErrNotDirectory || KindOf(nil) != nil || KindOf(errors.New("other")) != nil {
+		t.Errorf("KindOf should classify system errors, got %v for %v", KindOf(err), err)
+	}
+	_, err = sub.Join("a.txt").File().CopyWith(context.Background(), sub, CopyOptions{Conflict: ConflictFail})
+	if !errors.As(err, &fsErr) || fsErr.Path2 != sub.Join("a.txt").String() || fsErr.Kind() != ErrExist {
+		t.Errorf("a conflict should name both paths, got %v", err)
+	}
+
+	other, _ := dir.CreateSubdir("other")
+	other.CreateFileWithString("b.txt", "b", true)
+	err = dir.Clear(false)
+	var multi *MultiError
+	if !errors.As(err, &multi) || len(multi.Errs) != 2 {
+		t.Errorf("Clear should report every failure, got %v", err)
+	}
+	if _, err := dir.Join("missing").Dir().GetTreeContext(context.Background(), WalkOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetTreeContext should report a missing directory, got %v", err)
+	}
+
+	// calls going straight to the backend report an *Error too
+	missing := dir.Join("missing")
+	moved := missing
+	_, allErr := missing.Dir().All()
+	_, statErr := missing.Stat()
+	_, linkErr := sub.Join("a.txt").Readlink()
+	for name, err := range map[string]error{
+		"All":         allErr,
+		"Delete":      missing.Dir().Delete(false),
+		"DeletePath":  missing.DeletePath(false),
+		"SetPerm":     missing.SetPerm(0600),
+		"Stat":        statErr,
+		"Rename":      moved.Rename("other"),
+		"Readlink":    linkErr,
+		"File.Delete": missing.File().Delete(),
+	} {
+		if !errors.As(err, &fsErr) || !strings.HasPrefix(fsErr.Path, dir.String()) {
+			t.Errorf("%s should fail with an *Error, got %#v", name, err)
+		}
+	}
+	if err := moved.Rename("other"); !errors.Is(err, ErrNotFound) || !errors.As(err, &fsErr) || fsErr.Path2 != dir.Join("other").String() {
+		t.Errorf("Rename should name both paths, got %v", err)
+	}
+}
@@ -0,0 +1,584 @@
+package easyFS
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrPathEscape is returned when a path would resolve outside the directory
+// it must stay in, such as an archive entry or a name given to a Root like
+// "../../etc/passwd".
+var ErrPathEscape = errors.New("easyFS: path escapes the root directory")
+
+// ArchiveFormat is an archive file format.
+type ArchiveFormat int
+
+const (
+	// ArchiveAuto picks the format from the file name, or from the content when extracting.
+	ArchiveAuto ArchiveFormat = iota
+	ArchiveZip
+	ArchiveTar
+	ArchiveTarGz
+)
+
+func (f ArchiveFormat) String() string {
+	switch f {
+	case ArchiveZip:
+		return "zip"
+	case ArchiveTar:
+		return "tar"
+	case ArchiveTarGz:
+		return "tar.gz"
+	}
+	return "auto"
+}
+
+// ArchiveFormatOf returns the format matching the extension of name, or
+// ArchiveAuto if the extension is not known.
+func ArchiveFormatOf(name string) ArchiveFormat {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveZip
+	case strings.HasSuffix(lower, ".tar"):
+		return ArchiveTar
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveTarGz
+	}
+	return ArchiveAuto
+}
+
+// ArchiveOptions controls Dir.ArchiveToWith and File.ExtractToWith.
+type ArchiveOptions struct {
+	// Include only archives or extracts files matching it, relative to the archive root.
+	Include *Pattern
+	// Exclude skips matching files and directories, relative to the archive root.
+	Exclude *Pattern
+	// Ignore skips ignored paths when archiving.
+	Ignore *Ignore
+}
+
+// skip reports whether the relative slash path is filtered out.
+func (opts ArchiveOptions) skip(rel string, isDir bool) bool {
+	if opts.Exclude != nil && opts.Exclude.Match(rel) {
+		return true
+	}
+	return !isDir && opts.Include != nil && !opts.Include.Match(rel)
+}
+
+// ArchiveTo packs the directory into file, storing paths relative to the
+// directory together with their permissions and modification times. Symbolic
+// links are stored as links. The archive is written atomically and is left
+// out of itself when it lives inside the directory.
+//
+// Example:
+//
+//	dir := NewDir("/path/to/build")
+//	err := dir.ArchiveTo(NewFile("/path/to/build.tar.gz"), ArchiveAuto)
+func (d Dir) ArchiveTo(file File, format ArchiveFormat) error {
+	return d.ArchiveToWith(context.Background(), file, format, ArchiveOptions{})
+}
+
+// ArchiveToWith is like ArchiveTo but honours opts and stops as soon as ctx
+// is cancelled, leaving file untouched.
+func (d Dir) ArchiveToWith(ctx context.Context, file File, format ArchiveFormat, opts ArchiveOptions) error {
+	if format == ArchiveAuto {
+		format = ArchiveFormatOf(file.Name())
+	}
+	var writer archiveWriter
+	out, err := file.CreateAtomic()
+	if err != nil {
+		return err
+	}
+	defer out.Abort()
+	buffered := bufio.NewWriter(out)
+	switch format {
+	case ArchiveZip:
+		writer = zipWriter{zip.NewWriter(buffered)}
+	case ArchiveTar:
+		writer = tarWriter{tar.NewWriter(buffered), nil}
+	case ArchiveTarGz:
+		gz := gzip.NewWriter(buffered)
+		writer = tarWriter{tar.NewWriter(gz), gz}
+	default:
+		return &Error{Op: "archive", Path: file.String(), Err: fmt.Errorf("unknown archive format for %q", file.Name())}
+	}
+	err = d.WalkContext(ctx, WalkOptions{Ignore: opts.Ignore}, func(entry WalkEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filepath.Clean(entry.Path.String()) == filepath.Clean(file.String()) || filepath.Clean(entry.Path.String()) == filepath.Clean(out.temp.String()) {
+			return nil
+		}
+		rel := d.slashRel(entry.Path)
+		if opts.skip(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return writer.add(ctx, entry.Path, rel, info)
+	})
+	if cerr := writer.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+type archiveWriter interface {
+	add(ctx context.Context, p PathHandler, rel string, info PathInfo) error
+	Close() error
+}
+
+type zipWriter struct {
+	w *zip.Writer
+}
+
+func (z zipWriter) add(ctx context.Context, p PathHandler, rel string, info PathInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	if info.IsDir() {
+		header.Name += "/"
+	} else if info.Mode().IsRegular() {
+		header.Method = zip.Deflate
+	}
+	w, err := z.w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	return writeArchiveData(ctx, w, p, info)
+}
+
+func (z zipWriter) Close() error {
+	return z.w.Close()
+}
+
+type tarWriter struct {
+	w  *tar.Writer
+	gz *gzip.Writer
+}
+
+func (t tarWriter) add(ctx context.Context, p PathHandler, rel string, info PathInfo) error {
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := p.Readlink()
+		if err != nil {
+			return err
+		}
+		link = filepath.ToSlash(target.String())
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if err := t.w.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	return writeArchiveData(ctx, t.w, p, info)
+}
+
+func (t tarWriter) Close() error {
+	err := t.w.Close()
+	if t.gz != nil {
+		if gerr := t.gz.Close(); err == nil {
+			err = gerr
+		}
+	}
+	return err
+}
+
+// writeArchiveData writes the content of a regular file, or the target of a
+// symbolic link, to an archive entry.
+func writeArchiveData(ctx context.Context, w io.Writer, p PathHandler, info PathInfo) error {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := p.Readlink()
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, filepath.ToSlash(target.String()))
+		return err
+	case info.Mode().IsRegular():
+		file, err := p.open(os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if _, err := io.Copy(w, ctxReader{ctx, file}); err != nil {
+			if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+				return ctxErr(ctx, "archive", p)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtractTo unpacks the zip, tar or tar.gz archive into dest, restoring
+// permissions, modification times and symbolic links. The format is taken
+// from the file name, or detected from the content.
+//
+// Entries with absolute names, names climbing out with "..", symbolic links
+// pointing outside dest and entries written through such links are rejected
+// with an error wrapping ErrPathEscape. Entries extracted before the bad one
+// are kept.
+//
+// Example:
+//
+//	archive := NewFile("/path/to/upload.zip")
+//	err := archive.ExtractTo(NewDir("/path/to/unpacked"))
+func (f File) ExtractTo(dest Dir) error {
+	return f.ExtractToWith(context.Background(), dest, ArchiveOptions{})
+}
+
+// ExtractToWith is like ExtractTo but only extracts the entries selected by
+// opts and stops as soon as ctx is cancelled.
+func (f File) ExtractToWith(ctx context.Context, dest Dir, opts ArchiveOptions) error {
+	file, err := f.open(os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	format := ArchiveFormatOf(f.Name())
+	if format == ArchiveAuto {
+		if format, err = detectArchive(file); err != nil {
+			return err
+		}
+	}
+	if err := mkdirAll(dest.PathHandler, 0755); err != nil {
+		return err
+	}
+	x := &extractor{dest: dest, opts: opts}
+	switch format {
+	case ArchiveZip:
+		err = x.zip(ctx, file)
+	case ArchiveTar:
+		err = x.tar(ctx, tar.NewReader(bufio.NewReader(file)))
+	case ArchiveTarGz:
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(bufio.NewReader(file)); err == nil {
+			err = x.tar(ctx, tar.NewReader(gz))
+		}
+	default:
+		err = &Error{Op: "extract", Path: f.String(), Err: fmt.Errorf("unknown archive format")}
+	}
+	if err == nil {
+		err = x.finish()
+	}
+	return err
+}
+
+// detectArchive recognises the archive format by its magic bytes and rewinds
+// the file.
+func detectArchive(file FileHandle) (ArchiveFormat, error) {
+	header := make([]byte, 262)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return ArchiveAuto, err
+	}
+	header = header[:n]
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return ArchiveAuto, err
+	}
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return ArchiveZip, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return ArchiveTarGz, nil
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return ArchiveTar, nil
+	}
+	return ArchiveAuto, &Error{Op: "extract", Path: file.Name(), Err: fmt.Errorf("unknown archive format")}
+}
+
+type extractor struct {
+	dest Dir
+	opts ArchiveOptions
+	dirs []extractedDir
+}
+
+type extractedDir struct {
+	path    PathHandler
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (x *extractor) zip(ctx context.Context, file FileHandle) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	readerAt, ok := file.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		readerAt = bytes.NewReader(data)
+	}
+	archive, err := zip.NewReader(readerAt, info.Size())
+	if err != nil {
+		return err
+	}
+	for _, entry := range archive.File {
+		mode := entry.Mode()
+		err := x.entry(ctx, entry.Name, mode, entry.Modified, func() (io.ReadCloser, string, error) {
+			r, err := entry.Open()
+			if err != nil || mode&os.ModeSymlink == 0 {
+				return r, "", err
+			}
+			defer r.Close()
+			target, err := io.ReadAll(r)
+			return nil, string(target), err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) tar(ctx context.Context, archive *tar.Reader) error {
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		mode := header.FileInfo().Mode()
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink, tar.TypeLink:
+		default:
+			// devices, fifos and extended headers are not extracted
+			continue
+		}
+		err = x.entry(ctx, header.Name, mode, header.ModTime, func() (io.ReadCloser, string, error) {
+			switch header.Typeflag {
+			case tar.TypeSymlink:
+				return nil, header.Linkname, nil
+			case tar.TypeLink:
+				source, err := x.resolve(header.Linkname, true)
+				if err != nil {
+					return nil, "", err
+				}
+				r, err := source.open(os.O_RDONLY, 0)
+				return r, "", err
+			}
+			return io.NopCloser(archive), "", nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// resolve returns where the archive entry name ends up below the
+// destination, refusing names and symbolic links that lead outside it.
+func (x *extractor) resolve(name string, followLast bool) (PathHandler, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", &Error{Op: "extract", Path: name, Err: ErrPathEscape}
+	}
+	rel, err := resolveBelow(x.dest.PathHandler, name, followLast)
+	if err != nil {
+		return "", err
+	}
+	return x.dest.Join(filepath.FromSlash(rel)), nil
+}
+
+// entry extracts one archive entry. open returns the content of a file or the
+// target of a symbolic link.
+func (x *extractor) entry(ctx context.Context, name string, mode os.FileMode, modTime time.Time, open func() (io.ReadCloser, string, error)) error {
+	rel := strings.Trim(path.Clean(strings.ReplaceAll(name, `\`, "/")), "/")
+	if strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) || filepath.VolumeName(filepath.FromSlash(name)) != "" {
+		return &Error{Op: "extract", Path: name, Err: ErrPathEscape}
+	}
+	if rel == "." || rel == "" {
+		return nil
+	}
+	if err := ctxErr(ctx, "extract", x.dest.Join(filepath.FromSlash(rel))); err != nil {
+		return err
+	}
+	if x.opts.skip(rel, mode.IsDir()) || x.excludedParent(rel) {
+		return nil
+	}
+	target, err := x.resolve(rel, false)
+	if err != nil {
+		return err
+	}
+	if mode.IsDir() {
+		if err := mkdirAll(target, 0755); err != nil {
+			return err
+		}
+		x.dirs = append(x.dirs, extractedDir{path: target, mode: mode.Perm(), modTime: modTime})
+		return nil
+	}
+	if err := mkdirAll(target.Parent().PathHandler, 0755); err != nil {
+		return err
+	}
+	// never write through an existing link or into an existing directory
+	if info, err := target.Lstat(); err == nil {
+		if info.IsDir() {
+			return &Error{Op: "extract", Path: target.String(), Err: ErrIsDirectory}
+		}
+		if err := remove(target); err != nil {
+			return err
+		}
+	}
+	r, linkTarget, err := open()
+	if err != nil {
+		return err
+	}
+	if mode&os.ModeSymlink != 0 {
+		if err := x.checkLink(rel, linkTarget); err != nil {
+			return err
+		}
+		return PathHandler(filepath.FromSlash(linkTarget)).Symlink(target)
+	}
+	defer r.Close()
+	out, err := target.open(os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, ctxReader{ctx, r})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = target.SetPerm(mode.Perm())
+	}
+	if err != nil {
+		remove(target)
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			return ctxErr(ctx, "extract", target)
+		}
+		return err
+	}
+	if err := target.SetModTime(modTime); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// excludedParent reports whether a parent directory of rel is excluded, so
+// the entries below it are skipped like the directory itself.
+func (x *extractor) excludedParent(rel string) bool {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if x.opts.skip(dir, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLink refuses symbolic links whose target is absolute or resolves
+// outside the destination.
+func (x *extractor) checkLink(rel, target string) error {
+	if target == "" || path.IsAbs(target) || strings.HasPrefix(target, `\`) || filepath.VolumeName(filepath.FromSlash(target)) != "" {
+		return &Error{Op: "extract", Path: rel, Err: ErrPathEscape}
+	}
+	parent, err := resolveBelow(x.dest.PathHandler, path.Dir(rel), true)
+	if err != nil {
+		return err
+	}
+	if _, err := resolveBelow(x.dest.PathHandler, path.Join(parent, target), true); err != nil {
+		return &Error{Op: "extract", Path: rel, Err: ErrPathEscape}
+	}
+	return nil
+}
+
+// finish applies the permissions and times of extracted directories, deepest
+// first so that setting them does not change the parents again.
+func (x *extractor) finish() error {
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		dir := x.dirs[i]
+		if err := dir.path.SetPerm(dir.mode); err != nil {
+			return err
+		}
+		if err := dir.path.SetModTime(dir.modTime); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveBelow resolves the slash separated relative name below root,
+// following symbolic links in every component but the last unless
+// followLast is set. It returns the resolved slash separated path relative
+// to root, or an error wrapping ErrPathEscape if ".." or a link leads
+// outside root. Components that do not exist are taken as they are.
+func resolveBelow(root PathHandler, name string, followLast bool) (string, error) {
+	escape := &Error{Op: "resolve", Path: name, Err: ErrPathEscape}
+	rest := strings.Split(filepath.ToSlash(name), "/")
+	var resolved []string
+	hops := 0
+	for len(rest) > 0 {
+		part := rest[0]
+		rest = rest[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return "", escape
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+		resolved = append(resolved, part)
+		if len(rest) == 0 && !followLast {
+			break
+		}
+		p := root.Join(resolved...)
+		info, err := p.Lstat()
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if hops++; hops > maxSymlinkHops {
+			return "", &Error{Op: "resolve", Path: name, Err: errLoop}
+		}
+		target, err := p.Readlink()
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target.String()) || strings.HasPrefix(filepath.ToSlash(target.String()), "/") {
+			return "", escape
+		}
+		resolved = resolved[:len(resolved)-1]
+		rest = append(strings.Split(filepath.ToSlash(target.String()), "/"), rest...)
+	}
+	return strings.Join(resolved, "/"), nil
+}
@@ -0,0 +1,280 @@
+package easyFS
+
+import (
+	"errors"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// AtomicFile is a pending atomic write started with File.CreateAtomic. Data is
+// written to a temporary file next to the target, which only replaces the
+// target when Commit succeeds.
+type AtomicFile struct {
+	target PathHandler
+	temp   PathHandler
+	file   FileHandle
+	// perm is given to the file at Commit if setPerm is set; otherwise it
+	// keeps the mode it was created with, subject to the umask
+	perm    os.FileMode
+	setPerm bool
+	// exclusive makes Commit fail rather than replace an existing target
+	exclusive bool
+	// noSync skips flushing to stable storage, for copies
+	noSync bool
+	done   bool
+}
+
+// WriteOptions controls how Dir.CreateFileWithData writes a file.
+type WriteOptions struct {
+	// Atomic writes the file through a temporary file that replaces it in one
+	// step, so that after a crash it is either complete or absent. Without
+	// overwrite, a backend or volume that cannot hard link first claims the
+	// name with an empty file, which readers may briefly see and a crash may
+	// leave behind.
+	Atomic bool
+}
+
+// CreateAtomic starts an atomic write of the file. Write the new content to
+// the returned AtomicFile and call Commit to replace the file, or Abort to
+// leave it untouched. The permissions of an existing file are preserved; a
+// new file gets 0666 less the umask, as with os.Create. When the file is a
+// symbolic link, the file it points to is replaced and the link is kept.
+//
+// Example:
+//
+//	file := NewFile("/path/to/config.json")
+//	w, err := file.CreateAtomic()
+//	if err != nil {
+//	    return err
+//	}
+//	defer w.Abort()
+//	json.NewEncoder(w).Encode(config)
+//	err = w.Commit()
+func (f File) CreateAtomic() (*AtomicFile, error) {
+	return f.createAtomic(false)
+}
+
+// createAtomic is CreateAtomic, where exclusive makes Commit fail with
+// os.ErrExist instead of replacing an existing file. An exclusive Commit is
+// only all or nothing on backends implementing LinkFS; elsewhere the target
+// is created empty before the rename, see renameNoReplace.
+func (f File) createAtomic(exclusive bool) (*AtomicFile, error) {
+	if _, err := f.Lstat(); err == nil && exclusive {
+		return nil, &Error{Op: "create", Path: f.String(), Err: os.ErrExist}
+	}
+	target, err := resolveTarget(f.PathHandler)
+	if err != nil {
+		return nil, err
+	}
+	a := &AtomicFile{target: target, exclusive: exclusive}
+	createPerm := os.FileMode(0666)
+	if info, err := target.Stat(); err == nil {
+		if info.IsDir() {
+			return nil, &Error{Op: "open", Path: f.String(), Err: ErrIsDirectory}
+		}
+		// the content stays private until the mode is carried over
+		createPerm = 0600
+		a.perm, a.setPerm = info.Mode().Perm(), true
+	}
+	for attempt := 0; ; attempt++ {
+		temp := tempName(target)
+		file, err := temp.open(os.O_RDWR|os.O_CREATE|os.O_EXCL, createPerm)
+		if err == nil {
+			a.temp, a.file = temp, file
+			return a, nil
+		}
+		if !errors.Is(err, os.ErrExist) || attempt == 10 {
+			return nil, newError("create", f.PathHandler, err)
+		}
+	}
+}
+
+// resolveTarget follows p as long as it is a symbolic link, so that the
+// file a link points to is staged and replaced next to it.
+func resolveTarget(p PathHandler) (PathHandler, error) {
+	for hops := 0; ; hops++ {
+		info, err := p.Lstat()
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return p, nil
+		}
+		if hops == maxSymlinkHops {
+			return "", &Error{Op: "open", Path: p.String(), Err: errLoop}
+		}
+		target, err := p.Readlink()
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target.String()) {
+			target = p.Parent().Join(target.String())
+		}
+		p = target
+	}
+}
+
+// tempName returns a random hidden name next to p for staging its content.
+func tempName(p PathHandler) PathHandler {
+	return p.Parent().Join("." + p.Name() + ".tmp-" + strconv.FormatUint(rand.Uint64(), 36))
+}
+
+// Write writes data to the temporary file.
+func (a *AtomicFile) Write(data []byte) (int, error) {
+	n, err := a.file.Write(data)
+	if err != nil {
+		return n, newError("write", a.target, err)
+	}
+	return n, nil
+}
+
+// Commit flushes the temporary file to stable storage, gives it the
+// permissions of the target it replaces, renames it over the target and
+// syncs the parent directory.
+func (a *AtomicFile) Commit() error {
+	if a.done {
+		return &Error{Op: "commit", Path: a.target.String(), Err: os.ErrClosed}
+	}
+	a.done = true
+	var err error
+	if !a.noSync {
+		err = a.file.Sync()
+	}
+	if cerr := a.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && a.setPerm {
+		err = a.temp.SetPerm(a.perm)
+	}
+	if err == nil && a.exclusive {
+		err = renameNoReplace(a.temp, a.target)
+	} else if err == nil {
+		err = rename(a.temp, a.target)
+	}
+	if err != nil {
+		remove(a.temp)
+		return newError("commit", a.target, err)
+	}
+	if a.noSync {
+		return nil
+	}
+	if err := syncDir(a.target.Parent()); err != nil {
+		return newError("commit", a.target, err)
+	}
+	return nil
+}
+
+// Abort discards the temporary file and leaves the target untouched. It does
+// nothing after Commit, so it can be deferred.
+func (a *AtomicFile) Abort() error {
+	if a.done {
+		return nil
+	}
+	a.done = true
+	a.file.Close()
+	return remove(a.temp)
+}
+
+// renameNoReplace renames temp to target unless target exists, failing with
+// an error wrapping os.ErrExist then. Backends that can link do it in one step
+// and otherwise target is claimed with O_EXCL before the rename, leaving it
+// empty until the rename or for good after a crash in between. A directory
+// claims target by creating it empty and is renamed over it.
+func renameNoReplace(temp, target PathHandler) error {
+	info, err := temp.Lstat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return renameDirNoReplace(temp, target)
+	}
+	if l, ok := target.FileSystem().(LinkFS); ok && sameFileSystem(temp, target) {
+		err := l.Link(temp.String(), target.String())
+		if err == nil {
+			remove(temp)
+			return nil
+		}
+		if errors.Is(err, os.ErrExist) {
+			return err
+		}
+		// the file system may not support hard links
+	}
+	claim, err := target.open(os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	claim.Close()
+	if err := rename(temp, target); err != nil {
+		remove(target)
+		return err
+	}
+	return nil
+}
+
+// renameDirNoReplace is renameNoReplace for a directory. Windows cannot
+// rename over the empty claim, so there target is released again and checked
+// once more right before the rename.
+func renameDirNoReplace(temp, target PathHandler) error {
+	if err := target.FileSystem().Mkdir(target.String(), 0700); err != nil {
+		return newError("rename", target, err)
+	}
+	err := rename(temp, target)
+	if err == nil {
+		return nil
+	}
+	remove(target)
+	if !IsWindows() {
+		return err
+	}
+	if _, err := target.Lstat(); err == nil {
+		return &Error{Op: "rename", Path: temp.String(), Path2: target.String(), Err: os.ErrExist}
+	}
+	return rename(temp, target)
+}
+
+// syncDir flushes a directory so a rename inside it survives a crash. Backends
+// or platforms that cannot open or sync directories are silently accepted.
+func syncDir(d Dir) error {
+	dir, err := d.open(os.O_RDONLY, 0)
+	if err != nil {
+		return nil
+	}
+	defer dir.Close()
+	return syncHandle(dir)
+}
+
+// syncHandle flushes an open file, accepting handles that cannot be synced.
+func syncHandle(h FileHandle) error {
+	if err := h.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// WriteAtomic writes data to the file atomically: after a crash the file
+// holds either its old or its new content, never a truncated mix.
+//
+// Example:
+//
+//	file := NewFile(PathHandler("/path/to/file.txt"))
+//	err := file.WriteAtomic([]byte("Hello, World!"))
+func (f File) WriteAtomic(data []byte) error {
+	return f.writeAtomic(data, false)
+}
+
+func (f File) writeAtomic(data []byte, exclusive bool) error {
+	w, err := f.createAtomic(exclusive)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Commit()
+}
+
+// WriteStringAtomic writes the given string data to the file atomically.
+func (f File) WriteStringAtomic(data string) error {
+	return f.WriteAtomic([]byte(data))
+}
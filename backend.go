@@ -0,0 +1,365 @@
+package easyFS
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSystem is the storage backend that every PathHandler, File and Dir
+// operation is routed through. The default backend is OSFileSystem, which
+// talks to the local disk through the os package.
+//
+// Paths are passed to the backend exactly as they are held by the
+// PathHandler, using the host path separator.
+type FileSystem interface {
+	// OpenFile opens the named file with the given flags (os.O_RDONLY etc.) and permissions.
+	OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error)
+	// Stat returns information about the named file, following symbolic links.
+	Stat(name string) (os.FileInfo, error)
+	// Lstat returns information about the named file without following symbolic links.
+	Lstat(name string) (os.FileInfo, error)
+	// ReadDir returns the entries of the named directory sorted by name.
+	ReadDir(name string) ([]os.DirEntry, error)
+	// Mkdir creates a single directory.
+	Mkdir(name string, perm os.FileMode) error
+	// Remove removes a file or an empty directory.
+	Remove(name string) error
+	// Rename moves oldname to newname, replacing newname if it is a file.
+	Rename(oldname, newname string) error
+	// Chmod changes the permission bits of the named file.
+	Chmod(name string, mode os.FileMode) error
+	// Symlink creates newname as a symbolic link to oldname.
+	Symlink(oldname, newname string) error
+	// Readlink returns the destination of the named symbolic link.
+	Readlink(name string) (string, error)
+}
+
+// FileHandle is an open file returned by a FileSystem. *os.File satisfies it.
+type FileHandle interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+}
+
+// MkdirAllFS is implemented by backends that can create a directory together
+// with any missing parents more efficiently than one Mkdir call per level.
+type MkdirAllFS interface {
+	MkdirAll(name string, perm os.FileMode) error
+}
+
+// RemoveAllFS is implemented by backends that can remove a whole tree more
+// efficiently than walking it.
+type RemoveAllFS interface {
+	RemoveAll(name string) error
+}
+
+// ChtimesFS is implemented by backends that can change the access and
+// modification times of a path.
+type ChtimesFS interface {
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// LchownFS is implemented by backends that can change the owner of a path,
+// not following a final symbolic link.
+type LchownFS interface {
+	Lchown(name string, uid, gid int) error
+}
+
+// XattrFS is implemented by backends that store extended attributes.
+type XattrFS interface {
+	ListXattr(name string) ([]string, error)
+	GetXattr(name, attr string) ([]byte, error)
+	SetXattr(name, attr string, data []byte) error
+}
+
+// LinkFS is implemented by backends that can create hard links. Creating a
+// file atomically without replacing an existing one relies on it.
+type LinkFS interface {
+	Link(oldname, newname string) error
+}
+
+// OSFileSystem is the FileSystem backed by the local disk.
+type OSFileSystem struct{}
+
+func (OSFileSystem) OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (OSFileSystem) Stat(name string) (os.FileInfo, error)  { return os.Stat(name) }
+func (OSFileSystem) Lstat(name string) (os.FileInfo, error) { return os.Lstat(name) }
+func (OSFileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
+func (OSFileSystem) Mkdir(name string, perm os.FileMode) error    { return os.Mkdir(name, perm) }
+func (OSFileSystem) MkdirAll(name string, perm os.FileMode) error { return os.MkdirAll(name, perm) }
+func (OSFileSystem) Remove(name string) error                     { return os.Remove(name) }
+func (OSFileSystem) RemoveAll(name string) error                  { return os.RemoveAll(name) }
+func (OSFileSystem) Rename(oldname, newname string) error         { return os.Rename(oldname, newname) }
+func (OSFileSystem) Chmod(name string, mode os.FileMode) error    { return os.Chmod(name, mode) }
+func (OSFileSystem) Symlink(oldname, newname string) error        { return os.Symlink(oldname, newname) }
+func (OSFileSystem) Readlink(name string) (string, error)         { return os.Readlink(name) }
+func (OSFileSystem) Link(oldname, newname string) error           { return os.Link(oldname, newname) }
+func (OSFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+func (OSFileSystem) Lchown(name string, uid, gid int) error { return os.Lchown(name, uid, gid) }
+
+// ListXattr, GetXattr and SetXattr access extended attributes on Linux and
+// fail with errors.ErrUnsupported elsewhere.
+func (OSFileSystem) ListXattr(name string) ([]string, error)       { return listXattr(name) }
+func (OSFileSystem) GetXattr(name, attr string) ([]byte, error)    { return getXattr(name, attr) }
+func (OSFileSystem) SetXattr(name, attr string, data []byte) error { return setXattr(name, attr, data) }
+
+var (
+	backendMu sync.RWMutex
+	defaultFS FileSystem = OSFileSystem{}
+	mounts               = map[string]FileSystem{}
+)
+
+// SetFileSystem replaces the backend used for every path that is not under a
+// mount point and returns the previous one.
+//
+// Example:
+//
+//	prev := SetFileSystem(NewMemFileSystem())
+//	defer SetFileSystem(prev)
+func SetFileSystem(fsys FileSystem) FileSystem {
+	if fsys == nil {
+		fsys = OSFileSystem{}
+	}
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	prev := defaultFS
+	defaultFS = fsys
+	return prev
+}
+
+// Mount routes every path at or below root to fsys. Mount points are matched
+// lexically against the cleaned path, and the longest matching root wins.
+//
+// Example:
+//
+//	Mount("/mem", NewMemFileSystem())
+//	defer Unmount("/mem")
+func Mount(root PathHandler, fsys FileSystem) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	mounts[filepath.Clean(root.String())] = fsys
+}
+
+// Unmount removes the mount point at root.
+func Unmount(root PathHandler) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	delete(mounts, filepath.Clean(root.String()))
+}
+
+// FileSystem returns the backend responsible for the path.
+func (p PathHandler) FileSystem() FileSystem {
+	_, fsys := p.mount()
+	return fsys
+}
+
+// mount returns the mount point serving the path, "" for the default
+// backend, together with its backend.
+func (p PathHandler) mount() (string, FileSystem) {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	if len(mounts) == 0 {
+		return "", defaultFS
+	}
+	clean := filepath.Clean(p.String())
+	best, mountRoot, fsys := -1, "", defaultFS
+	for root, m := range mounts {
+		if len(root) > best && hasPathPrefix(clean, root) {
+			best, mountRoot, fsys = len(root), root, m
+		}
+	}
+	return mountRoot, fsys
+}
+
+// hasPathPrefix reports whether path is root or lies below it.
+func hasPathPrefix(path, root string) bool {
+	if path == root {
+		return true
+	}
+	if strings.HasSuffix(root, string(os.PathSeparator)) {
+		return strings.HasPrefix(path, root)
+	}
+	return strings.HasPrefix(path, root+string(os.PathSeparator))
+}
+
+// sameFileSystem reports whether both paths are served by the same backend.
+func sameFileSystem(a, b PathHandler) bool {
+	rootA, fsysA := a.mount()
+	rootB, fsysB := b.mount()
+	return rootA == rootB || equalBackends(fsysA, fsysB)
+}
+
+// equalBackends compares two backends, which may be mounted at several
+// points. Backends of a type that cannot be compared, such as a struct
+// holding a map, make == panic and are taken as different.
+func equalBackends(a, b FileSystem) (equal bool) {
+	defer func() {
+		if recover() != nil {
+			equal = false
+		}
+	}()
+	return a == b
+}
+
+// open opens the path through its backend.
+func (p PathHandler) open(flag int, perm os.FileMode) (FileHandle, error) {
+	file, err := p.FileSystem().OpenFile(p.String(), flag, perm)
+	if err != nil {
+		return nil, newError("open", p, err)
+	}
+	return file, nil
+}
+
+// readDir lists the directory p through its backend.
+func readDir(p PathHandler) ([]os.DirEntry, error) {
+	entries, err := p.FileSystem().ReadDir(p.String())
+	if err != nil {
+		return nil, newError("readdir", p, err)
+	}
+	return entries, nil
+}
+
+// remove removes the file or empty directory p through its backend.
+func remove(p PathHandler) error {
+	if err := p.FileSystem().Remove(p.String()); err != nil {
+		return newError("remove", p, err)
+	}
+	return nil
+}
+
+// readFile reads the whole file at p through its backend.
+func readFile(p PathHandler) ([]byte, error) {
+	file, err := p.open(os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, newError("read", p, err)
+	}
+	return data, nil
+}
+
+// writeFile writes data to p through its backend, creating or truncating it.
+func writeFile(p PathHandler, data []byte, perm os.FileMode) error {
+	file, err := p.open(os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return newError("write", p, err)
+	}
+	return nil
+}
+
+// mkdirAll creates p and any missing parents through its backend.
+func mkdirAll(p PathHandler, perm os.FileMode) error {
+	fsys := p.FileSystem()
+	if m, ok := fsys.(MkdirAllFS); ok {
+		if err := m.MkdirAll(p.String(), perm); err != nil {
+			return newError("mkdir", p, err)
+		}
+		return nil
+	}
+	info, err := fsys.Stat(p.String())
+	if err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &Error{Op: "mkdir", Path: p.String(), Err: ErrNotDirectory}
+	}
+	parent := p.Parent().PathHandler
+	if parent != p {
+		if err := mkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	err = fsys.Mkdir(p.String(), perm)
+	if err != nil && !(errors.Is(err, os.ErrExist) && p.IsDir()) {
+		return newError("mkdir", p, err)
+	}
+	return nil
+}
+
+// removeAll removes p and everything below it through its backend.
+func removeAll(p PathHandler) error {
+	fsys := p.FileSystem()
+	if r, ok := fsys.(RemoveAllFS); ok {
+		if err := r.RemoveAll(p.String()); err != nil {
+			return newError("remove", p, err)
+		}
+		return nil
+	}
+	info, err := fsys.Lstat(p.String())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return newError("remove", p, err)
+	}
+	if info.IsDir() {
+		entries, err := fsys.ReadDir(p.String())
+		if err != nil {
+			return newError("remove", p, err)
+		}
+		for _, entry := range entries {
+			if err := removeAll(p.Join(entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	err = fsys.Remove(p.String())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return newError("remove", p, err)
+	}
+	return nil
+}
+
+// chtimes changes the times of p, failing with errors.ErrUnsupported when the
+// backend cannot.
+func chtimes(p PathHandler, atime, mtime time.Time) error {
+	c, ok := p.FileSystem().(ChtimesFS)
+	if !ok {
+		return &Error{Op: "chtimes", Path: p.String(), Err: errors.ErrUnsupported}
+	}
+	if err := c.Chtimes(p.String(), atime, mtime); err != nil {
+		return newError("chtimes", p, err)
+	}
+	return nil
+}
+
+// rename moves oldpath to newpath, refusing to cross backends.
+func rename(oldpath, newpath PathHandler) error {
+	if !sameFileSystem(oldpath, newpath) {
+		return &Error{Op: "rename", Path: oldpath.String(), Path2: newpath.String(), Err: errCrossDevice}
+	}
+	if err := oldpath.FileSystem().Rename(oldpath.String(), newpath.String()); err != nil {
+		return newLinkError("rename", oldpath, newpath, err)
+	}
+	return nil
+}
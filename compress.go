@@ -0,0 +1,336 @@
+package easyFS
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// Compression is a compression format understood by CompressedFile.
+type Compression int
+
+const (
+	// CompressionAuto picks the format from the file extension, and when
+	// reading a file with an unknown extension, from its first bytes.
+	CompressionAuto Compression = iota
+	// CompressionNone reads and writes the raw bytes.
+	CompressionNone
+	// CompressionGzip is the gzip format (.gz).
+	CompressionGzip
+	// CompressionZlib is the zlib format (.zz, .zlib).
+	CompressionZlib
+	// CompressionBzip2 is the bzip2 format (.bz2). It can only be read.
+	CompressionBzip2
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZlib:
+		return "zlib"
+	case CompressionBzip2:
+		return "bzip2"
+	}
+	return "auto"
+}
+
+// CompressionOf returns the compression matching the extension of name, or
+// CompressionNone if the extension is not known.
+func CompressionOf(name string) Compression {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".gz"), strings.HasSuffix(lower, ".tgz"):
+		return CompressionGzip
+	case strings.HasSuffix(lower, ".zz"), strings.HasSuffix(lower, ".zlib"):
+		return CompressionZlib
+	case strings.HasSuffix(lower, ".bz2"), strings.HasSuffix(lower, ".tbz2"):
+		return CompressionBzip2
+	}
+	return CompressionNone
+}
+
+// CompressedFile is a view of a File whose content is transparently
+// decompressed when read and compressed when written. Create one with
+// File.Compressed. It only has methods that honour the compression; use
+// File for the underlying file and its raw bytes.
+type CompressedFile struct {
+	file        File
+	compression Compression
+}
+
+// Compressed returns a view of the file that decompresses on reads and
+// compresses on writes. With CompressionAuto a file named "app.log.gz" is
+// treated as gzip; when reading a file with an unknown extension, gzip, zlib
+// and bzip2 are also recognised by their magic bytes.
+//
+// Example:
+//
+//	log := NewFile("/var/log/app.log.1.gz").Compressed(CompressionAuto)
+//	next, err := log.IterateLine()
+//	for line, err := next(); err == nil; line, err = next() {
+//	    fmt.Println(line)
+//	}
+func (f File) Compressed(c Compression) CompressedFile {
+	return CompressedFile{file: f, compression: c}
+}
+
+// File returns the underlying file, whose methods work on the raw bytes.
+func (c CompressedFile) File() File {
+	return c.file
+}
+
+// String returns the path of the file.
+func (c CompressedFile) String() string {
+	return c.file.String()
+}
+
+// Compression returns the format used for writing: the one given to
+// File.Compressed, or the one matching the file extension.
+func (c CompressedFile) Compression() Compression {
+	if c.compression == CompressionAuto {
+		return CompressionOf(c.file.Name())
+	}
+	return c.compression
+}
+
+// Open opens the file for reading and returns a reader of the decompressed
+// content. The caller must close it.
+func (c CompressedFile) Open() (io.ReadCloser, error) {
+	if err := c.file.checkFile("read"); err != nil {
+		return nil, err
+	}
+	file, err := c.file.open(os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewReader(file)
+	compression := c.Compression()
+	if c.compression == CompressionAuto && compression == CompressionNone {
+		compression = sniffCompression(buffered)
+	}
+	var r io.Reader
+	switch compression {
+	case CompressionGzip:
+		r, err = gzip.NewReader(buffered)
+	case CompressionZlib:
+		r, err = zlib.NewReader(buffered)
+	case CompressionBzip2:
+		r = bzip2.NewReader(buffered)
+	default:
+		r = buffered
+	}
+	if err != nil {
+		file.Close()
+		return nil, &Error{Op: "read", Path: c.file.String(), Err: err}
+	}
+	return &compressedReader{Reader: r, file: file}, nil
+}
+
+// sniffCompression recognises gzip, zlib and bzip2 by their magic bytes
+// without consuming them.
+func sniffCompression(r *bufio.Reader) Compression {
+	magic, _ := r.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b, 0x08}):
+		return CompressionGzip
+	case len(magic) == 4 && bytes.HasPrefix(magic, []byte("BZh")) && magic[3] >= '1' && magic[3] <= '9':
+		return CompressionBzip2
+	case len(magic) >= 2 && magic[0] == 0x78 && (int(magic[0])<<8|int(magic[1]))%31 == 0 && inflates(r):
+		// a deflate stream with a 32K window: 78 01, 78 5e, 78 9c or 78 da
+		return CompressionZlib
+	}
+	return CompressionNone
+}
+
+// inflates tells whether the start of r decodes as zlib, as text can begin
+// with a valid zlib header too, such as "x^".
+func inflates(r *bufio.Reader) bool {
+	prefix, _ := r.Peek(512)
+	z, err := zlib.NewReader(bytes.NewReader(prefix))
+	if err != nil {
+		return false
+	}
+	_, err = io.Copy(io.Discard, z)
+	return err == nil || err == io.ErrUnexpectedEOF
+}
+
+type compressedReader struct {
+	io.Reader
+	file FileHandle
+}
+
+func (r *compressedReader) Close() error {
+	if closer, ok := r.Reader.(io.Closer); ok {
+		closer.Close()
+	}
+	return r.file.Close()
+}
+
+// Create truncates the file and returns a writer that compresses into it.
+// The caller must close it to flush the compressed stream.
+func (c CompressedFile) Create() (io.WriteCloser, error) {
+	return c.create(os.O_WRONLY | os.O_CREATE | os.O_TRUNC)
+}
+
+func (c CompressedFile) create(flag int) (io.WriteCloser, error) {
+	compression := c.Compression()
+	if compression == CompressionBzip2 {
+		return nil, &Error{Op: "write", Path: c.file.String(), Err: errors.ErrUnsupported}
+	}
+	file, err := c.file.open(flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &compressedWriter{file: file}
+	switch compression {
+	case CompressionGzip:
+		w.encoder = gzip.NewWriter(file)
+	case CompressionZlib:
+		w.encoder = zlib.NewWriter(file)
+	}
+	return w, nil
+}
+
+type compressedWriter struct {
+	file    FileHandle
+	encoder io.WriteCloser
+}
+
+func (w *compressedWriter) Write(data []byte) (int, error) {
+	if w.encoder == nil {
+		return w.file.Write(data)
+	}
+	return w.encoder.Write(data)
+}
+
+func (w *compressedWriter) Close() error {
+	var err error
+	if w.encoder != nil {
+		err = w.encoder.Close()
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Read reads and decompresses the entire file.
+func (c CompressedFile) Read() ([]byte, error) {
+	r, err := c.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// ReadString reads and decompresses the entire file as a string.
+func (c CompressedFile) ReadString() (string, error) {
+	data, err := c.Read()
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ChunkReader is like File.ChunkReader but returns decompressed chunks.
+func (c CompressedFile) ChunkReader(size int64) (func() ([]byte, error, bool), func() error, error) {
+	r, err := c.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return func() ([]byte, error, bool) {
+			data := make([]byte, size)
+			n, err := io.ReadFull(r, data)
+			if err == io.ErrUnexpectedEOF {
+				err = nil
+			}
+			if err != nil {
+				r.Close()
+				return data[:n], err, true
+			}
+			return data[:n], nil, false
+		}, func() error {
+			return r.Close()
+		}, nil
+}
+
+// IterateLine is like File.IterateLine but iterates over the decompressed
+// lines. The file is closed once the iterator returns an error, including
+// io.EOF at the end.
+func (c CompressedFile) IterateLine() (func() (string, error), error) {
+	r, err := c.Open()
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(r)
+	return func() (string, error) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			r.Close()
+			return line, err
+		}
+		return line[:len(line)-1], nil
+	}, nil
+}
+
+// Write compresses data and replaces the content of the file with it.
+func (c CompressedFile) Write(data []byte) error {
+	w, err := c.Create()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// WriteString compresses the string and replaces the content of the file with it.
+func (c CompressedFile) WriteString(data string) error {
+	return c.Write([]byte(data))
+}
+
+// AppendIterative returns a function that appends data to the file. With
+// gzip every call adds a complete gzip member, which gzip readers, including
+// Read and IterateLine, decode as one continuous stream. zlib and bzip2
+// streams cannot be appended to and fail with errors.ErrUnsupported.
+//
+// Example:
+//
+//	appendNext, err := NewFile("/path/to/events.log.gz").Compressed(CompressionAuto).AppendIterative()
+//	appendNext([]byte("started\n"))
+func (c CompressedFile) AppendIterative() (func(data []byte) error, error) {
+	switch c.Compression() {
+	case CompressionZlib, CompressionBzip2:
+		return nil, &Error{Op: "append", Path: c.file.String(), Err: errors.ErrUnsupported}
+	}
+	// Make sure the file can be opened in append mode
+	file, err := c.file.open(os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	return func(data []byte) error {
+		w, err := c.create(os.O_APPEND | os.O_CREATE | os.O_WRONLY)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
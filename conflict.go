@@ -0,0 +1,177 @@
+package easyFS
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictPolicy decides what a copy, move or rename does when its
+// destination already exists.
+type ConflictPolicy int
+
+const (
+	// ConflictOverwrite replaces the existing destination. It is the default.
+	ConflictOverwrite ConflictPolicy = iota
+	// ConflictFail stops with an *Error of kind ErrExist.
+	ConflictFail
+	// ConflictSkip leaves the destination alone and the source where it is.
+	ConflictSkip
+	// ConflictOverwriteIfNewer replaces the destination only if the source was
+	// modified more recently, and skips it otherwise.
+	ConflictOverwriteIfNewer
+	// ConflictKeepBoth writes to a free numbered name next to the destination,
+	// such as "report (1).pdf".
+	ConflictKeepBoth
+)
+
+func (c ConflictPolicy) String() string {
+	switch c {
+	case ConflictOverwrite:
+		return "overwrite"
+	case ConflictFail:
+		return "fail"
+	case ConflictSkip:
+		return "skip"
+	case ConflictOverwriteIfNewer:
+		return "overwrite-if-newer"
+	case ConflictKeepBoth:
+		return "keep-both"
+	}
+	return fmt.Sprintf("ConflictPolicy(%d)", int(c))
+}
+
+// ConflictFunc decides the policy for one conflict between src and the
+// existing dest.
+type ConflictFunc func(src, dest PathHandler) ConflictPolicy
+
+// MoveOptions controls PathHandler.MoveWith and PathHandler.RenameWith.
+type MoveOptions struct {
+	// Conflict is applied when the destination exists. Unlike CopyOptions,
+	// where directories are merged, a move replaces an existing directory
+	// as a whole: with ConflictOverwrite its old content is gone.
+	Conflict ConflictPolicy
+	// OnConflict, if set, is asked for the policy instead of Conflict.
+	OnConflict ConflictFunc
+}
+
+// resolveConflict decides what happens to dest when src is copied or moved
+// there. It returns the path to write to, or ok false if the operation must
+// be skipped.
+func resolveConflict(policy ConflictPolicy, decide ConflictFunc, op string, src, dest PathHandler) (target PathHandler, ok bool, err error) {
+	destInfo, err := dest.Lstat()
+	if errors.Is(err, os.ErrNotExist) {
+		return dest, true, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if decide != nil {
+		policy = decide(src, dest)
+	}
+	switch policy {
+	case ConflictOverwrite:
+		return dest, true, nil
+	case ConflictFail:
+		return "", false, &Error{Op: op, Path: src.String(), Path2: dest.String(), Err: ErrExist}
+	case ConflictSkip:
+		return dest, false, nil
+	case ConflictOverwriteIfNewer:
+		srcInfo, err := src.Stat()
+		if err != nil {
+			if srcInfo, err = src.Lstat(); err != nil {
+				return "", false, err
+			}
+		}
+		return dest, srcInfo.ModTime().After(destInfo.ModTime()), nil
+	case ConflictKeepBoth:
+		target, err := freeName(dest)
+		return target, err == nil, err
+	}
+	return "", false, fmt.Errorf("easyFS: unknown conflict policy %v", policy)
+}
+
+// freeName returns the first of "name (1).ext", "name (2).ext", ... next to
+// p that does not exist.
+func freeName(p PathHandler) (PathHandler, error) {
+	name := p.Name()
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if stem == "" {
+		// a dot file such as ".env" has no extension
+		stem, ext = name, ""
+	}
+	for n := 1; ; n++ {
+		candidate := p.Parent().Join(fmt.Sprintf("%s (%d)%s", stem, n, ext))
+		if _, err := candidate.Lstat(); errors.Is(err, os.ErrNotExist) {
+			return candidate, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// RenameWith renames the path to newName in the same directory like Rename,
+// applying opts if an entry called newName already exists. A skipped rename
+// leaves the path unchanged and returns nil.
+//
+// Example:
+//
+//	p := PathHandler("/srv/uploads/tmp-4f2a")
+//	err := p.RenameWith("report.pdf", MoveOptions{Conflict: ConflictKeepBoth})
+//	// p is now /srv/uploads/report.pdf, or /srv/uploads/report (1).pdf
+func (p *PathHandler) RenameWith(newName string, opts MoveOptions) error {
+	return p.moveTo("rename", p.Parent().Join(newName), opts)
+}
+
+// MoveWith moves the path into the directory newPath like Move, applying
+// opts if an entry of the same name already exists there. A skipped move
+// leaves the path unchanged and returns nil.
+//
+// Example:
+//
+//	err := p.MoveWith("/srv/archive", MoveOptions{
+//	    OnConflict: func(src, dest PathHandler) ConflictPolicy {
+//	        if dest.IsDir() {
+//	            return ConflictFail
+//	        }
+//	        return ConflictOverwriteIfNewer
+//	    },
+//	})
+func (p *PathHandler) MoveWith(newPath PathHandler, opts MoveOptions) error {
+	return p.moveTo("move", newPath.Join(p.Name()), opts)
+}
+
+func (p *PathHandler) moveTo(op string, dest PathHandler, opts MoveOptions) error {
+	if filepath.Clean(dest.String()) == filepath.Clean(p.String()) {
+		return nil
+	}
+	if _, err := p.Lstat(); err != nil {
+		return err
+	}
+	dest, ok, err := resolveConflict(opts.Conflict, opts.OnConflict, op, *p, dest)
+	if err != nil || !ok {
+		return err
+	}
+	if _, err := dest.Lstat(); err == nil {
+		// replace the old entry through a transaction, so that it comes back
+		// if the move fails, whatever its type
+		tx := NewTx()
+		if _, err := tx.move(op, *p, dest); err != nil {
+			err = newLinkError(op, *p, dest, err)
+			if rerr := tx.Rollback(); rerr != nil {
+				return errors.Join(err, rerr)
+			}
+			return err
+		}
+		*p = dest
+		return tx.Commit()
+	}
+	if err := movePath(*p, dest); err != nil {
+		return newLinkError(op, *p, dest, err)
+	}
+	*p = dest
+	return nil
+}
@@ -0,0 +1,326 @@
+package easyFS
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// CopyOptions controls Dir.CopyWith and File.CopyWith.
+type CopyOptions struct {
+	// Ignore skips matching source paths; ignored directories are not copied at all.
+	Ignore *Ignore
+	// Progress, if set, is called periodically with the progress of the copy,
+	// and a last time with Done set once it has finished or failed. It is
+	// called from the copying goroutines, one call at a time, so it should
+	// return quickly; send the value to a channel to handle it elsewhere.
+	Progress func(CopyProgress)
+	// ProgressInterval is the minimum time between two Progress calls. It
+	// defaults to half a second.
+	ProgressInterval time.Duration
+	// PreScan walks the source directory before copying so that Progress
+	// can report the totals and an ETA.
+	PreScan bool
+	// Workers is the number of files Dir.CopyWith copies at the same time.
+	// Directories are still created one by one, each before its content.
+	// 0 and 1 copy serially.
+	Workers int
+	// ContinueOnError makes Dir.CopyWith copy everything it can instead of
+	// stopping at the first failure, and return all errors in a *MultiError.
+	// Cancelling ctx still stops it.
+	ContinueOnError bool
+	// PreserveMode copies the permission bits, including setuid, setgid and
+	// sticky. Otherwise new files get 0666 less the umask and replaced ones
+	// keep theirs.
+	PreserveMode bool
+	// PreserveTimes copies the access and modification times. Where the
+	// access time is not available it is set to the modification time.
+	PreserveTimes bool
+	// PreserveOwner copies the user and group, on backends implementing
+	// LchownFS. It is skipped silently when the process lacks the privilege.
+	PreserveOwner bool
+	// PreserveXattrs copies extended attributes, on backends implementing
+	// XattrFS (the OS backend on Linux). Attributes the destination does not
+	// support or the process may not set are skipped.
+	PreserveXattrs bool
+	// CopySymlinks recreates symbolic links as links to the same target
+	// instead of copying what they point to.
+	CopySymlinks bool
+	// Conflict is applied to every destination file that exists already.
+	// Directories are merged, so the policy applies to the files in them.
+	Conflict ConflictPolicy
+	// OnConflict, if set, is asked for the policy of each conflict instead
+	// of Conflict.
+	OnConflict ConflictFunc
+
+	progress *copyTracker
+}
+
+// CopyWith copies the directory and its contents to dest like Copy, honouring
+// opts. Every file is copied like File.CopyWith does, so it only replaces an
+// existing one once complete. It stops as soon as ctx is cancelled.
+//
+// Example:
+//
+//	err := dir.CopyWith(ctx, "/path/to/destination", CopyOptions{Ignore: GitIgnore(dir)})
+//
+// Copying eight files at a time, skipping the ones that fail:
+//
+//	err := dir.CopyWith(ctx, "/mnt/nas/backup", CopyOptions{Workers: 8, ContinueOnError: true})
+//
+// Making a faithful backup:
+//
+//	err := dir.CopyWith(ctx, "/mnt/backup/home", CopyOptions{
+//	    PreserveMode: true, PreserveTimes: true, PreserveOwner: true, PreserveXattrs: true,
+//	    CopySymlinks: true,
+//	})
+//
+// Reporting progress:
+//
+//	err := dir.CopyWith(ctx, "/mnt/backup/photos", CopyOptions{
+//	    PreScan: true,
+//	    Progress: func(p CopyProgress) {
+//	        fmt.Printf("%d/%d files, %d/%d bytes, ETA %s\n", p.FilesCopied, p.FilesTotal, p.BytesCopied, p.BytesTotal, p.ETA)
+//	    },
+//	})
+func (d Dir) CopyWith(ctx context.Context, dest PathHandler, opts CopyOptions) error {
+	if tracker, started := opts.tracker(); started {
+		defer tracker.finish()
+		if opts.PreScan {
+			files, bytes, err := scanCopy(ctx, d, opts)
+			if err != nil {
+				return err
+			}
+			tracker.setTotals(files, bytes)
+		}
+	}
+	state := &copyState{keepGoing: opts.ContinueOnError}
+	if opts.Workers > 1 {
+		d.copyParallel(ctx, dest, opts, state)
+	} else {
+		d.copyTree(ctx, dest, opts, state, func(src File, destDir Dir) {
+			_, err := src.CopyWith(ctx, destDir, opts)
+			state.add(err)
+		})
+	}
+	if opts.preserves() && !state.stopped() {
+		// the files are all written, so the directory times stay put
+		for _, dir := range state.dirs {
+			state.add(opts.preserveMetadata(dir.src, dir.dest, dir.info))
+		}
+	}
+	return state.err()
+}
+
+// copyTree recreates the directories below d in dest, parents first, and
+// hands every file to copyFile. It stops early once state says so.
+func (d Dir) copyTree(ctx context.Context, dest PathHandler, opts CopyOptions, state *copyState, copyFile func(src File, destDir Dir)) {
+	if state.add(ctxErr(ctx, "copy", d.PathHandler)) {
+		return
+	}
+	all, err := d.All()
+	if state.add(err) {
+		return
+	}
+	destDir := dest.Dir()
+	if state.add(destDir.CreateIfNotExist()) {
+		return
+	}
+	for _, entry := range all {
+		if state.add(ctxErr(ctx, "copy", entry)) || state.stopped() {
+			return
+		}
+		isDir := entry.IsDir() && !(opts.CopySymlinks && entry.IsSymlink())
+		if opts.Ignore.Match(entry, isDir) {
+			continue
+		}
+		if isDir {
+			entry.Dir().copyTree(ctx, destDir.Join(entry.Name()), opts, state, copyFile)
+		} else {
+			copyFile(entry.File(), destDir)
+		}
+	}
+	if opts.preserves() {
+		info, err := d.Stat()
+		if state.add(err) {
+			return
+		}
+		state.dirs = append(state.dirs, copiedDir{d.PathHandler, destDir.PathHandler, info})
+	}
+}
+
+// CopyWith copies the file into destDir like Copy, honouring opts. The copy
+// is written to a temporary file next to the destination, which only
+// replaces it once complete, so a failed or cancelled copy leaves an existing
+// destination untouched. It stops as soon as ctx is cancelled. When opts skip
+// an existing destination, it is returned with a nil error. When the data was
+// copied but metadata asked for in opts could not be preserved, the copy is
+// kept and returned together with the error.
+//
+// Example:
+//
+//	copied, err := file.CopyWith(ctx, NewDir("/srv/inbox"), CopyOptions{Conflict: ConflictKeepBoth})
+func (f File) CopyWith(ctx context.Context, destDir Dir, opts CopyOptions) (File, error) {
+	tracker, started := opts.tracker()
+	if started {
+		defer tracker.finish()
+	}
+	if err := ctxErr(ctx, "copy", f.PathHandler); err != nil {
+		return File{}, err
+	}
+	if opts.CopySymlinks && f.IsSymlink() {
+		return f.copySymlink(destDir, opts, tracker)
+	}
+	if err := f.checkFile("copy"); err != nil {
+		return File{}, err
+	}
+	srcFile, err := f.open(os.O_RDONLY, 0)
+	if err != nil {
+		return File{}, err
+	}
+	defer srcFile.Close()
+	info, err := srcFile.Stat()
+	if err != nil {
+		return File{}, err
+	}
+
+	var src io.Reader = ctxReader{ctx, srcFile}
+	if tracker != nil {
+		if started {
+			tracker.setTotals(1, info.Size())
+		}
+		tracker.setCurrent(f.PathHandler)
+		src = progressReader{src, tracker}
+	}
+
+	err = destDir.CreateIfNotExist()
+	if err != nil {
+		return File{}, err
+	}
+
+	destFilePath, ok, err := resolveConflict(opts.Conflict, opts.OnConflict, "copy", f.PathHandler, destDir.Join(f.Name()))
+	if err != nil {
+		return File{}, err
+	}
+	if !ok {
+		tracker.skipFile(info.Size())
+		return destFilePath.File(), nil
+	}
+	w, err := destFilePath.File().createAtomic(false)
+	if err != nil {
+		return File{}, err
+	}
+	w.noSync = true
+	if opts.PreserveMode {
+		// Commit sets the mode last, after the owner was changed
+		w.perm, w.setPerm = info.Mode()&preservedModeBits, true
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		w.Abort()
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			return File{}, ctxErr(ctx, "copy", f.PathHandler)
+		}
+		return File{}, err
+	}
+	// the data is complete, so a metadata failure does not discard it
+	merr := opts.preserveMetadata(f.PathHandler, w.temp, info)
+	if err := w.Commit(); err != nil {
+		return File{}, err
+	}
+	tracker.fileDone()
+	if merr != nil {
+		return destFilePath.File(), metadataError(f.PathHandler, destFilePath, merr)
+	}
+	return destFilePath.File(), nil
+}
+
+// copyParallel copies the tree with opts.Workers goroutines copying files
+// while the calling goroutine creates the directories and feeds them.
+func (d Dir) copyParallel(ctx context.Context, dest PathHandler, opts CopyOptions, state *copyState) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	state.cancel = cancel
+	type job struct {
+		src     File
+		destDir Dir
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for range opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if state.stopped() {
+					continue
+				}
+				_, err := j.src.CopyWith(ctx, j.destDir, opts)
+				state.add(err)
+			}
+		}()
+	}
+	d.copyTree(ctx, dest, opts, state, func(src File, destDir Dir) {
+		select {
+		case jobs <- job{src, destDir}:
+		case <-ctx.Done():
+		}
+	})
+	close(jobs)
+	wg.Wait()
+}
+
+// copyState collects the errors of a recursive copy, which stops at the
+// first one unless keepGoing is set. Cancellation always stops it. It also
+// lists the copied directories, children before parents, whose metadata is
+// preserved once all files are written.
+type copyState struct {
+	keepGoing bool
+	cancel    func()
+	dirs      []copiedDir
+
+	mu   sync.Mutex
+	errs []error
+	stop bool
+}
+
+type copiedDir struct {
+	src, dest PathHandler
+	info      os.FileInfo
+}
+
+// add records err, if any, and tells whether there was one. Errors after
+// the copy stopped are the fallout of stopping and are dropped.
+func (c *copyState) add(err error) bool {
+	if err == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop {
+		return true
+	}
+	c.errs = append(c.errs, err)
+	if !c.keepGoing || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		c.stop = true
+		if c.cancel != nil {
+			c.cancel()
+		}
+	}
+	return true
+}
+
+func (c *copyState) stopped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stop
+}
+
+// err returns the only error as is, or a MultiError.
+func (c *copyState) err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return joinErrors(c.errs)
+}
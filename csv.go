@@ -0,0 +1,360 @@
+package easyFS
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// CSVOptions controls the CSV helpers.
+type CSVOptions struct {
+	// Comma is the field delimiter. It defaults to a tab for ".tsv" files and to ',' otherwise.
+	Comma rune
+	// Comment, if set, marks lines starting with it as comments when reading.
+	Comment rune
+	// LazyQuotes accepts quotes inside unquoted fields when reading. It is
+	// always on for tab separated files, which rarely quote fields.
+	LazyQuotes bool
+}
+
+func (opts CSVOptions) reader(f File, r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = opts.comma(f)
+	reader.Comment = opts.Comment
+	reader.LazyQuotes = opts.LazyQuotes || reader.Comma == '\t'
+	reader.ReuseRecord = true
+	return reader
+}
+
+func (opts CSVOptions) comma(f File) rune {
+	if opts.Comma != 0 {
+		return opts.Comma
+	}
+	if strings.EqualFold(f.Ext(), ".tsv") {
+		return '\t'
+	}
+	return ','
+}
+
+// IterateCSV returns an iterator over the rows of the CSV or TSV file, read
+// one at a time. The yielded slice is reused by the next row, so copy it to
+// keep it. A malformed row is yielded with an error, after which the
+// iteration stops.
+//
+// Example:
+//
+//	for row, err := range IterateCSV(NewFile("/path/to/data.tsv"), CSVOptions{}) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(row[0])
+//	}
+func IterateCSV(f File, opts CSVOptions) iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		file, err := f.open(os.O_RDONLY, 0)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer file.Close()
+		reader := opts.reader(f, bufio.NewReader(file))
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, &Error{Op: "read csv", Path: f.String(), Err: err})
+				return
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}
+}
+
+// WriteCSV replaces the content of the file with the rows. The file is
+// written atomically, so on failure it keeps its previous content.
+//
+// Example:
+//
+//	err := WriteCSV(NewFile("/path/to/out.csv"), slices.Values([][]string{{"id", "name"}, {"1", "ana"}}), CSVOptions{})
+func WriteCSV(f File, rows iter.Seq[[]string], opts CSVOptions) error {
+	return writeCSV(f, opts, func(w *csv.Writer) error {
+		for row := range rows {
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func writeCSV(f File, opts CSVOptions, write func(w *csv.Writer) error) error {
+	file, err := f.CreateAtomic()
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+	w := csv.NewWriter(file)
+	w.Comma = opts.comma(f)
+	err = write(w)
+	if err == nil {
+		w.Flush()
+		err = w.Error()
+	}
+	if err != nil {
+		return &Error{Op: "write csv", Path: f.String(), Err: err}
+	}
+	return file.Commit()
+}
+
+// IterateCSVRecords returns an iterator that maps every row of the CSV or
+// TSV file to a struct of type T, using the first row as header. A column is
+// stored in the exported field whose `csv:"name"` tag, or else whose name,
+// matches the header case-insensitively; `csv:"-"` skips a field. Fields can
+// be strings, booleans, integers, floats or implement
+// encoding.TextUnmarshaler. Columns without a field are ignored. Embedded
+// struct pointers are allocated when one of their fields is read.
+//
+// Example:
+//
+//	type User struct {
+//	    ID    int    `csv:"id"`
+//	    Name  string `csv:"name"`
+//	    Admin bool   `csv:"is_admin"`
+//	}
+//	for user, err := range IterateCSVRecords[User](NewFile("/path/to/users.csv"), CSVOptions{}) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(user.Name)
+//	}
+func IterateCSVRecords[T any](f File, opts CSVOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		fields, err := csvFields(reflect.TypeFor[T]())
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		var columns []int
+		record := 0
+		for row, err := range IterateCSV(f, opts) {
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if columns == nil {
+				columns = make([]int, len(row))
+				for i, name := range row {
+					columns[i] = -1
+					for j, field := range fields {
+						if strings.EqualFold(field.name, strings.TrimSpace(name)) {
+							columns[i] = j
+							break
+						}
+					}
+				}
+				continue
+			}
+			record++
+			var value T
+			v := reflect.ValueOf(&value).Elem()
+			for i, text := range row {
+				if i >= len(columns) || columns[i] < 0 {
+					continue
+				}
+				field := fields[columns[i]]
+				fv, err := allocFieldByIndex(v, field.index)
+				if err == nil {
+					err = setCSVField(fv, text)
+				}
+				if err != nil {
+					yield(zero, &Error{Op: "read csv", Path: f.String(), Err: fmt.Errorf("record %d, column %q: %w", record, field.name, err)})
+					return
+				}
+			}
+			if !yield(value, nil) {
+				return
+			}
+		}
+	}
+}
+
+// WriteCSVRecords replaces the content of the file with a header row and one
+// row per record, using the same field mapping as IterateCSVRecords. The
+// fields of a nil embedded struct pointer are written empty. Like WriteCSV it
+// writes atomically.
+//
+// Example:
+//
+//	err := WriteCSVRecords(NewFile("/path/to/users.csv"), slices.Values(users), CSVOptions{})
+func WriteCSVRecords[T any](f File, records iter.Seq[T], opts CSVOptions) error {
+	fields, err := csvFields(reflect.TypeFor[T]())
+	if err != nil {
+		return err
+	}
+	return writeCSV(f, opts, func(w *csv.Writer) error {
+		row := make([]string, len(fields))
+		for i, field := range fields {
+			row[i] = field.name
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+		for record := range records {
+			// addressable, so pointer receiver MarshalText methods are found
+			value := reflect.ValueOf(&record).Elem()
+			for i, field := range fields {
+				fv, err := value.FieldByIndexErr(field.index)
+				if err != nil {
+					// a field of a nil embedded struct pointer
+					row[i] = ""
+					continue
+				}
+				text, err := formatCSVField(fv)
+				if err != nil {
+					return fmt.Errorf("column %q: %w", field.name, err)
+				}
+				row[i] = text
+			}
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type csvField struct {
+	name  string
+	index []int
+}
+
+// csvFields lists the mapped fields of the struct type t.
+func csvFields(t reflect.Type) ([]csvField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("easyFS: CSV records must be structs, not %s", t)
+	}
+	var fields []csvField
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("csv"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, csvField{name: name, index: field.Index})
+	}
+	return fields, nil
+}
+
+// allocFieldByIndex is like reflect.Value.FieldByIndex but allocates the nil
+// embedded struct pointers on the way.
+func allocFieldByIndex(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot allocate unexported embedded %s", v.Type())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+var textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+func setCSVField(v reflect.Value, text string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+	if v.Kind() == reflect.String {
+		v.SetString(text)
+		return nil
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+var textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+
+// formatCSVField formats a field, writing nil pointers and interfaces empty.
+func formatCSVField(v reflect.Value) (string, error) {
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return "", nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textMarshalerType) {
+		text, err := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return formatCSVField(v.Elem())
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported field type %s", v.Type())
+}
@@ -1,6 +1,7 @@
 package easyFS
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 )
@@ -33,7 +34,10 @@ func (d Dir) CreateIfNotExist() error {
 	if d.Exists() && d.IsDir() {
 		return nil
 	}
-	return os.MkdirAll(d.String(), os.ModePerm)
+	if err := mkdirAll(d.PathHandler, os.ModePerm); err != nil {
+		return newError("mkdir", d.PathHandler, err)
+	}
+	return nil
 }
 
 // All returns all paths within the directory.
@@ -47,7 +51,7 @@ func (d Dir) CreateIfNotExist() error {
 //	dir := Dir{"/path/to/directory"}
 //	paths, err := dir.All()
 func (d Dir) All() ([]PathHandler, error) {
-	entries, err := os.ReadDir(d.String())
+	entries, err := readDir(d.PathHandler)
 	if err != nil {
 		return nil, err
 	}
@@ -119,13 +123,11 @@ func (d Dir) Dirs() ([]Dir, error) {
 //	dir := Dir{"/path/to/directory"}
 //	err := dir.Delete(true)
 func (d Dir) Delete(recursive bool) error {
-	if recursive {
-		return os.RemoveAll(d.String())
-	}
-	return os.Remove(d.String())
+	return d.DeletePath(recursive)
 }
 
 // DeleteSubFile deletes a file within the directory.
+// The name is not confined to the directory; use a Root for untrusted names.
 //
 // Args:
 //   - name: Name of the file to delete.
@@ -143,6 +145,7 @@ func (d Dir) DeleteSubFile(name string) error {
 }
 
 // DeleteSubDir deletes a subdirectory within the directory.
+// The name is not confined to the directory; use a Root for untrusted names.
 //
 // Args:
 //   - name: Name of the subdirectory to delete.
@@ -161,6 +164,8 @@ func (d Dir) DeleteSubDir(name string, recursive bool) error {
 }
 
 // Copy copies the directory and its contents to the specified destination.
+// The tree is recreated as it is, each subdirectory below its copied parent,
+// so dest/sub/file.txt is the copy of sub/file.txt.
 //
 // Args:
 //   - dest: Destination path to copy the directory.
@@ -173,26 +178,20 @@ func (d Dir) DeleteSubDir(name string, recursive bool) error {
 //	dir := Dir{"/path/to/source"}
 //	err := dir.Copy("/path/to/destination")
 func (d Dir) Copy(dest PathHandler) error {
-	all, err := d.All()
-	if err != nil {
-		return err
-	}
-	destDir := dest.Dir()
-	if err := destDir.CreateIfNotExist(); err != nil {
-		return err
-	}
-	for _, entry := range all {
-		if entry.IsDir() {
-			if err := entry.Dir().Copy(destDir.PathHandler); err != nil {
-				return err
-			}
-		} else {
-			if _, err := entry.File().Copy(destDir); err != nil {
-				return err
-			}
-		}
-	}
-	return nil
+	return d.CopyContext(context.Background(), dest)
+}
+
+// CopyContext is like Copy but stops as soon as ctx is cancelled. A partially
+// copied file is discarded, leaving an existing destination file untouched,
+// and the returned error wraps ctx.Err() with the path where the copy stopped.
+//
+// Example:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+//	defer cancel()
+//	err := dir.CopyContext(ctx, "/path/to/destination")
+func (d Dir) CopyContext(ctx context.Context, dest PathHandler) error {
+	return d.CopyWith(ctx, dest, CopyOptions{})
 }
 
 // HasDir checks if the directory contains a subdirectory with the given name.
@@ -232,9 +231,9 @@ func (d Dir) HasFile(name string) bool {
 // Find finds paths matching the specified pattern within the directory.
 //
 // Args:
-//   - match: Pattern to match against.
+//   - match: Glob pattern relative to the directory, see CompilePattern. "*.txt" matches at any depth, "src/**/*_test.go" below src.
 //   - recursive: If true, searches recursively within subdirectories.
-//   - quantity: Maximum number of matching paths to return (0 for all).
+//   - quantity: Maximum number of matching paths to return (0 or less for all). The search stops once it is reached.
 //
 // Returns:
 //   - []PathHandler: List of matching paths.
@@ -244,30 +243,37 @@ func (d Dir) HasFile(name string) bool {
 //	dir := Dir{"/path/to/directory"}
 //	paths := dir.Find("*.txt", true, 5)
 func (d Dir) Find(match string, recursive bool, quantity int) []PathHandler {
-	if quantity == 0 {
-		return []PathHandler{}
-	} else {
-		paths := []PathHandler{}
-		d.forEach(recursive, func(p PathHandler) {
-			matched, err := filepath.Match(match, p.String())
-			if matched {
-				paths = append(paths, p)
-				quantity--
-			}
-			if quantity == 0 || err != nil {
-				return
-			}
-		})
-		return paths
+	paths, _ := d.FindContext(context.Background(), match, recursive, quantity)
+	return paths
+}
+
+// FindContext is like Find but stops as soon as ctx is cancelled, returning
+// the paths found so far together with the error.
+func (d Dir) FindContext(ctx context.Context, match string, recursive bool, quantity int) ([]PathHandler, error) {
+	pattern, err := CompilePattern(match)
+	if err != nil {
+		return []PathHandler{}, err
 	}
+	return d.FindWith(ctx, pattern, findOptions(recursive, quantity, FindAny))
+}
+
+// FindPattern is like Find but takes a pattern compiled with CompilePattern.
+//
+// Example:
+//
+//	tests := MustCompilePattern("src/**/*_test.go")
+//	paths := dir.FindPattern(tests, true, -1)
+func (d Dir) FindPattern(pattern *Pattern, recursive bool, quantity int) []PathHandler {
+	paths, _ := d.FindWith(context.Background(), pattern, findOptions(recursive, quantity, FindAny))
+	return paths
 }
 
 // FindFile finds files matching the specified pattern within the directory.
 //
 // Args:
-//   - match: Pattern to match against.
+//   - match: Glob pattern relative to the directory, see CompilePattern. "*.txt" matches at any depth, "src/**/*_test.go" below src.
 //   - recursive: If true, searches recursively within subdirectories.
-//   - quantity: Maximum number of matching files to return (0 for all).
+//   - quantity: Maximum number of matching files to return (0 or less for all). The search stops once it is reached.
 //
 // Returns:
 //   - []File: List of matching files.
@@ -277,32 +283,41 @@ func (d Dir) Find(match string, recursive bool, quantity int) []PathHandler {
 //	dir := Dir{"/path/to/directory"}
 //	files := dir.FindFile("*.txt", true, 5)
 func (d Dir) FindFile(match string, recursive bool, quantity int) []File {
-	// find the file in the dir
-	if quantity == 0 {
-		return []File{}
-	} else {
-		files := []File{}
-		d.forEach(recursive, func(p PathHandler) {
-			matched, err := filepath.Match(match, p.String())
-			if matched && p.IsFile() {
-				files = append(files, p.File())
-				quantity--
-			}
-			if quantity == 0 || err != nil {
-				return
-			}
-		})
-		return files
+	files, _ := d.FindFileContext(context.Background(), match, recursive, quantity)
+	return files
+}
+
+// FindFileContext is like FindFile but stops as soon as ctx is cancelled,
+// returning the files found so far together with the error.
+func (d Dir) FindFileContext(ctx context.Context, match string, recursive bool, quantity int) ([]File, error) {
+	pattern, err := CompilePattern(match)
+	if err != nil {
+		return []File{}, err
 	}
+	return d.findFile(ctx, pattern, recursive, quantity)
+}
+
+// FindFilePattern is like FindFile but takes a pattern compiled with CompilePattern.
+func (d Dir) FindFilePattern(pattern *Pattern, recursive bool, quantity int) []File {
+	files, _ := d.findFile(context.Background(), pattern, recursive, quantity)
+	return files
+}
 
+func (d Dir) findFile(ctx context.Context, pattern *Pattern, recursive bool, quantity int) ([]File, error) {
+	paths, err := d.FindWith(ctx, pattern, findOptions(recursive, quantity, FindFiles))
+	files := []File{}
+	for _, p := range paths {
+		files = append(files, p.File())
+	}
+	return files, err
 }
 
 // FindDir finds subdirectories matching the specified pattern within the directory.
 //
 // Args:
-//   - match: Pattern to match against.
+//   - match: Glob pattern relative to the directory, see CompilePattern. "*.txt" matches at any depth, "src/**/*_test.go" below src.
 //   - recursive: If true, searches recursively within subdirectories.
-//   - quantity: Maximum number of matching directories to return (0 for all).
+//   - quantity: Maximum number of matching directories to return (0 or less for all). The search stops once it is reached.
 //
 // Returns:
 //   - []Dir: List of matching subdirectories.
@@ -312,23 +327,106 @@ func (d Dir) FindFile(match string, recursive bool, quantity int) []File {
 //	dir := Dir{"/path/to/directory"}
 //	subdirs := dir.FindDir("*", true, 5)
 func (d Dir) FindDir(match string, recursive bool, quantity int) []Dir {
-	// find the dir in the dir
-	if quantity == 0 {
-		return []Dir{}
-	} else {
-		dirs := []Dir{}
-		d.forEach(recursive, func(p PathHandler) {
-			matched, err := filepath.Match(match, p.String())
-			if matched && p.IsDir() {
-				dirs = append(dirs, p.Dir())
-				quantity--
-			}
-			if quantity == 0 || err != nil {
-				return
-			}
-		})
-		return dirs
+	dirs, _ := d.FindDirContext(context.Background(), match, recursive, quantity)
+	return dirs
+}
+
+// FindDirContext is like FindDir but stops as soon as ctx is cancelled,
+// returning the directories found so far together with the error.
+func (d Dir) FindDirContext(ctx context.Context, match string, recursive bool, quantity int) ([]Dir, error) {
+	pattern, err := CompilePattern(match)
+	if err != nil {
+		return []Dir{}, err
+	}
+	return d.findDir(ctx, pattern, recursive, quantity)
+}
+
+// FindDirPattern is like FindDir but takes a pattern compiled with CompilePattern.
+func (d Dir) FindDirPattern(pattern *Pattern, recursive bool, quantity int) []Dir {
+	dirs, _ := d.findDir(context.Background(), pattern, recursive, quantity)
+	return dirs
+}
+
+func (d Dir) findDir(ctx context.Context, pattern *Pattern, recursive bool, quantity int) ([]Dir, error) {
+	paths, err := d.FindWith(ctx, pattern, findOptions(recursive, quantity, FindDirs))
+	dirs := []Dir{}
+	for _, p := range paths {
+		dirs = append(dirs, p.Dir())
 	}
+	return dirs, err
+}
+
+// FindType restricts the results of FindWith.
+type FindType int
+
+const (
+	// FindAny returns files and directories.
+	FindAny FindType = iota
+	// FindFiles only returns files.
+	FindFiles
+	// FindDirs only returns directories.
+	FindDirs
+)
+
+// FindOptions controls FindWith.
+type FindOptions struct {
+	WalkOptions
+	// Limit stops the search after this many matches. 0 or less means no limit.
+	Limit int
+	// Type restricts the results to files or directories.
+	Type FindType
+
+	// keep, if set, leaves out the paths it rejects and does not descend
+	// into them.
+	keep func(p PathHandler) bool
+}
+
+func findOptions(recursive bool, quantity int, findType FindType) FindOptions {
+	opts := FindOptions{Limit: quantity, Type: findType}
+	if !recursive {
+		opts.MaxDepth = 1
+	}
+	return opts
+}
+
+// FindWith finds paths matching pattern within the directory, honouring the
+// walk options such as MaxDepth and Ignore. It stops as soon as Limit matches
+// were found or ctx is cancelled, returning the paths found so far.
+//
+// Example:
+//
+//	opts := FindOptions{WalkOptions: WalkOptions{Ignore: GitIgnore(dir)}, Type: FindFiles}
+//	paths, err := dir.FindWith(ctx, MustCompilePattern("*.go"), opts)
+func (d Dir) FindWith(ctx context.Context, pattern *Pattern, opts FindOptions) ([]PathHandler, error) {
+	paths := []PathHandler{}
+	err := d.WalkContext(ctx, opts.WalkOptions, func(entry WalkEntry, err error) error {
+		if err != nil {
+			// unreadable directories are skipped
+			return nil
+		}
+		if opts.keep != nil && !opts.keep(entry.Path) {
+			// SkipDir would skip the siblings of anything but a directory
+			if entry.IsDir() || opts.FollowSymlinks && entry.Path.IsDir() {
+				return SkipDir
+			}
+			return nil
+		}
+		if !pattern.Match(d.rel(entry.Path)) {
+			return nil
+		}
+		switch {
+		case opts.Type == FindFiles && !entry.Path.IsFile():
+			return nil
+		case opts.Type == FindDirs && !entry.Path.IsDir():
+			return nil
+		}
+		paths = append(paths, entry.Path)
+		if len(paths) == opts.Limit {
+			return SkipAll
+		}
+		return nil
+	})
+	return paths, err
 }
 
 // CreateSubdir creates a subdirectory within the directory.
@@ -356,6 +454,7 @@ func (d Dir) CreateSubdir(name string) (Dir, error) {
 }
 
 // CreateFile creates a file within the directory.
+// The name is not confined to the directory; use a Root for untrusted names.
 //
 // Args:
 //   - name: Name of the file to create.
@@ -381,11 +480,20 @@ func (d Dir) CreateFile(name string, overwrite bool) (File, error) {
 }
 
 // CreateFileWithData creates a file with the given data within the directory.
+// By default the file is created and then written, and an existing file is
+// written whatever overwrite says. With WriteOptions.Atomic the file is
+// written in one crash-safe step, see File.WriteAtomic, and an existing file
+// is only replaced when overwrite is true; otherwise the call fails with
+// os.ErrExist. The check is part of the atomic step, so of concurrent
+// creations without overwrite only one succeeds. Without overwrite the step
+// is only crash-safe on backends implementing LinkFS; others briefly hold an
+// empty file at the name, see WriteOptions.
 //
 // Args:
 //   - name: Name of the file to create.
 //   - data: Data to write to the file.
 //   - overwrite: If true, overwrites the file if it already exists.
+//   - opts: Optional WriteOptions; only the first is used.
 //
 // Returns:
 //   - File: Created file.
@@ -395,8 +503,15 @@ func (d Dir) CreateFile(name string, overwrite bool) (File, error) {
 //
 //	dir := Dir{"/path/to/directory"}
 //	file, err := dir.CreateFileWithData("file.txt", []byte("Hello"), true)
-func (d Dir) CreateFileWithData(name string, data []byte, overwrite bool) (File, error) {
+//	config, err := dir.CreateFileWithData("config.json", data, true, WriteOptions{Atomic: true})
+func (d Dir) CreateFileWithData(name string, data []byte, overwrite bool, opts ...WriteOptions) (File, error) {
 	file := Join(d.String(), name).File()
+	if len(opts) > 0 && opts[0].Atomic {
+		if err := file.writeAtomic(data, !overwrite); err != nil {
+			return File{}, err
+		}
+		return file, nil
+	}
 	err := file.Create(overwrite)
 	if err != nil {
 		return File{}, err
@@ -440,18 +555,60 @@ func (d Dir) CreateFileWithString(name string, data string, overwrite bool) File
 //	tree := dir.GetTree()
 
 func (d Dir) GetTree() DirStructure {
-	return getTree(d)
+	tree, _ := d.GetTreeContext(context.Background(), WalkOptions{})
+	return tree
+}
+
+// GetTreeWith is like GetTree but skips paths matched by opts.Ignore and does
+// not descend below opts.MaxDepth.
+//
+// Example:
+//
+//	tree := dir.GetTreeWith(WalkOptions{Ignore: GitIgnore(dir)})
+func (d Dir) GetTreeWith(opts WalkOptions) DirStructure {
+	tree, _ := d.GetTreeContext(context.Background(), opts)
+	return tree
 }
 
-func getTree(p Dir) DirStructure {
+// GetTreeContext is like GetTreeWith but reports the directories it could
+// not read, which show up empty in the tree, in a *MultiError if there are
+// several. It stops as soon as ctx is cancelled, returning the tree built so
+// far.
+//
+// Example:
+//
+//	tree, err := dir.GetTreeContext(ctx, WalkOptions{MaxDepth: 3})
+func (d Dir) GetTreeContext(ctx context.Context, opts WalkOptions) (DirStructure, error) {
+	var errs []error
+	tree := getTree(ctx, d, opts, 1, &errs)
+	return tree, joinErrors(errs)
+}
+
+func getTree(ctx context.Context, p Dir, opts WalkOptions, depth int, errs *[]error) DirStructure {
+	tree := DirStructure{Dirs: map[string]DirStructure{}}
+	if err := ctxErr(ctx, "tree", p.PathHandler); err != nil {
+		*errs = append(*errs, err)
+		return tree
+	}
 	allEntry, err := p.All()
 	if err != nil {
-		return DirStructure{}
+		*errs = append(*errs, err)
+		return tree
 	}
-	tree := DirStructure{}
 	for _, entry := range allEntry {
-		if entry.IsDir() {
-			tree.Dirs[entry.String()] = getTree(entry.Dir())
+		isDir := entry.IsDir()
+		if opts.Ignore.Match(entry, isDir) {
+			continue
+		}
+		if isDir {
+			if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+				tree.Dirs[entry.String()] = DirStructure{Dirs: map[string]DirStructure{}}
+				continue
+			}
+			tree.Dirs[entry.String()] = getTree(ctx, entry.Dir(), opts, depth+1, errs)
+			if ctx.Err() != nil {
+				return tree
+			}
 		} else {
 			tree.Files = append(tree.Files, entry.File())
 		}
@@ -469,21 +626,21 @@ func getTree(p Dir) DirStructure {
 //	dir := Dir{"/path/to/directory"}
 //	paths := dir.GetAllPathExists()
 func (d Dir) GetAllPathExists() []PathHandler {
-	all, err := d.All()
-	if err != nil {
-		return []PathHandler{}
-	} else {
-		paths := []PathHandler{}
-		for _, entry := range all {
-			paths = append(paths, entry)
-			if entry.IsDir() {
-				entryDir := entry.Dir()
-				entryPaths := entryDir.GetAllPathExists()
-				paths = append(paths, entryPaths...)
-			}
+	paths, _ := d.GetAllPathExistsContext(context.Background())
+	return paths
+}
+
+// GetAllPathExistsContext is like GetAllPathExists but stops as soon as ctx is
+// cancelled, returning the paths collected so far together with the error.
+func (d Dir) GetAllPathExistsContext(ctx context.Context) ([]PathHandler, error) {
+	paths := []PathHandler{}
+	err := d.WalkContext(ctx, WalkOptions{}, func(entry WalkEntry, err error) error {
+		if err == nil {
+			paths = append(paths, entry.Path)
 		}
-		return paths
-	}
+		return nil
+	})
+	return paths, err
 }
 
 // Clear deletes all contents within the directory.
@@ -499,6 +656,13 @@ func (d Dir) GetAllPathExists() []PathHandler {
 //	dir := Dir{"/path/to/directory"}
 //	err := dir.Clear(true)
 func (d Dir) Clear(force bool) error {
+	return d.ClearContext(context.Background(), force)
+}
+
+// ClearContext is like Clear but stops before the next entry once ctx is
+// cancelled. Entries that fail to delete are skipped; the error is the only
+// failure, or a *MultiError holding all of them.
+func (d Dir) ClearContext(ctx context.Context, force bool) error {
 	// clear everything inside the dir but not the dir itself
 	if d.IsEmpty() {
 		return nil
@@ -507,11 +671,17 @@ func (d Dir) Clear(force bool) error {
 		if err != nil {
 			return err
 		}
+		var errs []error
 		for _, entry := range all_entries {
-			entry.DeletePath(force)
+			if err := ctxErr(ctx, "clear", entry); err != nil {
+				return joinErrors(append(errs, err))
+			}
+			if err := entry.DeletePath(force); err != nil {
+				errs = append(errs, err)
+			}
 		}
+		return joinErrors(errs)
 	}
-	return nil
 }
 
 // IsEmpty checks if the directory is empty.
@@ -531,21 +701,16 @@ func (d Dir) IsEmpty() bool {
 	return len(entries) == 0
 }
 
-// forEach iterates over each path within the directory.
-//
-// Args:
-//   - recursive: If true, iterates recursively over subdirectories.
-//   - handler: Handler function to execute for each path.
-func (d Dir) forEach(recursive bool, handler func(PathHandler)) {
-	entries, err := d.All()
+// rel returns p relative to the directory, or p itself if it is not below it.
+func (d Dir) rel(p PathHandler) string {
+	rel, err := filepath.Rel(d.String(), p.String())
 	if err != nil {
-		return
-	}
-	for _, entry := range entries {
-		handler(entry)
-		if entry.IsDir() && recursive {
-			entryDir := entry.Dir()
-			entryDir.forEach(recursive, handler)
-		}
+		return p.String()
 	}
+	return rel
+}
+
+// slashRel is like rel but always uses "/" as separator, as reports and archives do.
+func (d Dir) slashRel(p PathHandler) string {
+	return filepath.ToSlash(d.rel(p))
 }
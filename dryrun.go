@@ -0,0 +1,473 @@
+package easyFS
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DryRunOp is a change recorded by a DryRunFileSystem instead of being made.
+type DryRunOp struct {
+	// Op is one of "create", "write", "append", "mkdir", "remove", "rename",
+	// "chmod", "chtimes" and "symlink".
+	Op string
+	// Path is the path the operation applies to.
+	Path string
+	// NewPath is the destination of a rename or symlink.
+	NewPath string
+	// Mode is the permission of a create, mkdir or chmod.
+	Mode os.FileMode
+	// Size is the number of bytes written by a create, write or append.
+	Size int64
+}
+
+func (op DryRunOp) String() string {
+	switch op.Op {
+	case "rename":
+		return op.Op + " " + op.Path + " -> " + op.NewPath
+	case "symlink":
+		return op.Op + " " + op.NewPath + " -> " + op.Path
+	case "create", "write", "append":
+		return fmt.Sprintf("%s %s (%d bytes)", op.Op, op.Path, op.Size)
+	case "mkdir", "chmod":
+		return fmt.Sprintf("%s %s %#o", op.Op, op.Path, op.Mode)
+	}
+	return op.Op + " " + op.Path
+}
+
+// dryRunPlan is the log shared by the backends wrapped by one DryRun call.
+type dryRunPlan struct {
+	mu  sync.Mutex
+	ops []DryRunOp
+}
+
+// add records op and returns its index.
+func (p *dryRunPlan) add(op DryRunOp) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ops = append(p.ops, op)
+	return len(p.ops) - 1
+}
+
+// DryRunFileSystem wraps a backend and records every change instead of
+// making it. Reads are served by the wrapped backend, overlaid with the
+// recorded changes: removed paths disappear and created files and
+// directories show up (empty), so code that checks what it did keeps
+// working. Renamed directories show up without their content.
+//
+// Example:
+//
+//	dry := NewDryRunFileSystem(OSFileSystem{})
+//	prev := SetFileSystem(dry)
+//	err := NewDir("/tmp/cache").Clear(true)
+//	SetFileSystem(prev)
+//	for _, op := range dry.Plan() {
+//	    fmt.Println(op)
+//	}
+type DryRunFileSystem struct {
+	base FileSystem
+	plan *dryRunPlan
+
+	mu      sync.RWMutex
+	created map[string]os.FileMode
+	removed map[string]bool
+	// files maps the files created in the dry run to their create op
+	files map[string]int
+}
+
+// NewDryRunFileSystem returns a DryRunFileSystem recording the changes that
+// would be made to base.
+func NewDryRunFileSystem(base FileSystem) *DryRunFileSystem {
+	return newDryRun(base, &dryRunPlan{})
+}
+
+func newDryRun(base FileSystem, plan *dryRunPlan) *DryRunFileSystem {
+	return &DryRunFileSystem{base: base, plan: plan, created: map[string]os.FileMode{}, removed: map[string]bool{}, files: map[string]int{}}
+}
+
+// Plan returns the recorded changes in the order they were requested.
+func (d *DryRunFileSystem) Plan() []DryRunOp {
+	d.plan.mu.Lock()
+	defer d.plan.mu.Unlock()
+	return append([]DryRunOp(nil), d.plan.ops...)
+}
+
+// DryRun runs fn with every backend, the default one and all mounts, wrapped
+// in a DryRunFileSystem, and returns the changes fn would have made. The
+// backends are swapped globally for the duration of fn, so other goroutines
+// using easyFS at the same time are dry-run too.
+//
+// Example:
+//
+//	plan, err := DryRun(func() error {
+//	    return NewDir("/srv/old-releases").Delete(true)
+//	})
+//	for _, op := range plan {
+//	    fmt.Println(op) // remove /srv/old-releases/v1/app, ...
+//	}
+func DryRun(fn func() error) ([]DryRunOp, error) {
+	plan := &dryRunPlan{}
+	backendMu.Lock()
+	prevDefault, prevMounts := defaultFS, mounts
+	defaultFS = newDryRun(prevDefault, plan)
+	mounts = make(map[string]FileSystem, len(prevMounts))
+	for root, fsys := range prevMounts {
+		mounts[root] = newDryRun(fsys, plan)
+	}
+	backendMu.Unlock()
+	defer func() {
+		backendMu.Lock()
+		defaultFS, mounts = prevDefault, prevMounts
+		backendMu.Unlock()
+	}()
+	err := fn()
+	plan.mu.Lock()
+	defer plan.mu.Unlock()
+	return append([]DryRunOp(nil), plan.ops...), err
+}
+
+// state returns the overlaid mode of name: created tells whether it was
+// created in the dry run and gone whether it was removed.
+func (d *DryRunFileSystem) state(name string) (mode os.FileMode, created, gone bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	key := filepath.Clean(name)
+	if mode, ok := d.created[key]; ok {
+		return mode, true, false
+	}
+	for p := key; ; p = filepath.Dir(p) {
+		if d.removed[p] {
+			return 0, false, true
+		}
+		if _, ok := d.created[p]; ok || filepath.Dir(p) == p {
+			return 0, false, false
+		}
+	}
+}
+
+func (d *DryRunFileSystem) markCreated(name string, mode os.FileMode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.created[filepath.Clean(name)] = mode
+}
+
+func (d *DryRunFileSystem) markRemoved(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := filepath.Clean(name)
+	for p := range d.created {
+		if hasPathPrefix(p, key) {
+			delete(d.created, p)
+		}
+	}
+	for p := range d.files {
+		if hasPathPrefix(p, key) {
+			delete(d.files, p)
+		}
+	}
+	d.removed[key] = true
+}
+
+func (d *DryRunFileSystem) stat(name string, lstat bool) (os.FileInfo, error) {
+	mode, created, gone := d.state(name)
+	if gone {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	if created {
+		return dryRunInfo{name: filepath.Base(name), mode: mode}, nil
+	}
+	if lstat {
+		return d.base.Lstat(name)
+	}
+	return d.base.Stat(name)
+}
+
+// Stat returns the overlaid information about the named file.
+func (d *DryRunFileSystem) Stat(name string) (os.FileInfo, error) {
+	return d.stat(name, false)
+}
+
+// Lstat returns the overlaid information about the named file without
+// following a symbolic link in the base backend.
+func (d *DryRunFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return d.stat(name, true)
+}
+
+// ReadDir lists the base entries that were not removed and the entries created in the dry run.
+func (d *DryRunFileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	info, err := d.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	byName := map[string]os.DirEntry{}
+	if _, created, _ := d.state(name); !created {
+		entries, err := d.base.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if _, _, gone := d.state(filepath.Join(name, entry.Name())); !gone {
+				byName[entry.Name()] = entry
+			}
+		}
+	}
+	d.mu.RLock()
+	key := filepath.Clean(name)
+	for p, mode := range d.created {
+		if filepath.Dir(p) == key && p != key {
+			byName[filepath.Base(p)] = fs.FileInfoToDirEntry(dryRunInfo{name: filepath.Base(p), mode: mode})
+		}
+	}
+	d.mu.RUnlock()
+	entries := make([]os.DirEntry, 0, len(byName))
+	for _, entry := range byName {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// OpenFile opens files for reading from the base backend. Opening for
+// writing records a create, write or append, and returns a handle that
+// counts and discards the written bytes.
+func (d *DryRunFileSystem) OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error) {
+	info, err := d.Stat(name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		if _, created, _ := d.state(name); created && exists {
+			return &dryRunFile{name: name, info: info, op: -1}, nil
+		}
+		if !exists {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		return d.base.OpenFile(name, flag, perm)
+	}
+	switch {
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case exists && info.IsDir():
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if parent, err := d.Stat(filepath.Dir(name)); err != nil || !parent.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	op := DryRunOp{Op: "write", Path: name}
+	switch {
+	case !exists:
+		op.Op, op.Mode = "create", perm.Perm()
+		d.markCreated(name, perm.Perm())
+		info = dryRunInfo{name: filepath.Base(name), mode: perm.Perm()}
+	case flag&os.O_APPEND != 0:
+		op.Op = "append"
+	}
+	index := d.plan.add(op)
+	if !exists {
+		d.mu.Lock()
+		d.files[filepath.Clean(name)] = index
+		d.mu.Unlock()
+	}
+	return &dryRunFile{name: name, info: info, op: index, plan: d.plan}, nil
+}
+
+// Mkdir records the creation of a directory.
+func (d *DryRunFileSystem) Mkdir(name string, perm os.FileMode) error {
+	if _, err := d.Lstat(name); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	if parent, err := d.Stat(filepath.Dir(name)); err != nil || !parent.IsDir() {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrNotExist}
+	}
+	d.plan.add(DryRunOp{Op: "mkdir", Path: name, Mode: perm.Perm()})
+	d.markCreated(name, os.ModeDir|perm.Perm())
+	return nil
+}
+
+// Remove records the removal of a file or an empty directory.
+func (d *DryRunFileSystem) Remove(name string) error {
+	info, err := d.Lstat(name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if info.IsDir() {
+		entries, err := d.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+		}
+	}
+	d.plan.add(DryRunOp{Op: "remove", Path: name})
+	d.markRemoved(name)
+	return nil
+}
+
+// Rename records a rename. The new path shows up with the mode of the old one.
+// A file created in the dry run, such as the temporary file of an atomic
+// write, is recorded as created or written at the new path instead.
+func (d *DryRunFileSystem) Rename(oldname, newname string) error {
+	info, err := d.Lstat(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: os.ErrNotExist}
+	}
+	_, replaced := d.Lstat(newname)
+	d.mu.Lock()
+	index, ok := d.files[filepath.Clean(oldname)]
+	d.mu.Unlock()
+	if !ok {
+		d.plan.add(DryRunOp{Op: "rename", Path: oldname, NewPath: newname})
+	}
+	d.markRemoved(oldname)
+	d.markCreated(newname, info.Mode())
+	d.mu.Lock()
+	delete(d.files, filepath.Clean(newname))
+	d.mu.Unlock()
+	if ok {
+		d.plan.mu.Lock()
+		for i := index; i < len(d.plan.ops); i++ {
+			if d.plan.ops[i].Path == oldname {
+				d.plan.ops[i].Path = newname
+			}
+		}
+		if replaced == nil {
+			d.plan.ops[index].Op = "write"
+		}
+		d.plan.mu.Unlock()
+		d.mu.Lock()
+		d.files[filepath.Clean(newname)] = index
+		d.mu.Unlock()
+	}
+	return nil
+}
+
+// Chmod records a permission change. The mode of a file created in the dry
+// run is recorded with its creation instead.
+func (d *DryRunFileSystem) Chmod(name string, mode os.FileMode) error {
+	if _, err := d.Stat(name); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	index, ok := d.files[filepath.Clean(name)]
+	d.mu.Unlock()
+	if ok {
+		d.plan.mu.Lock()
+		d.plan.ops[index].Mode = mode.Perm()
+		d.plan.mu.Unlock()
+		return nil
+	}
+	d.plan.add(DryRunOp{Op: "chmod", Path: name, Mode: mode.Perm()})
+	return nil
+}
+
+// Chtimes records a change of modification time.
+func (d *DryRunFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	if _, err := d.Stat(name); err != nil {
+		return err
+	}
+	d.plan.add(DryRunOp{Op: "chtimes", Path: name})
+	return nil
+}
+
+// Symlink records the creation of newname as a symbolic link to oldname.
+func (d *DryRunFileSystem) Symlink(oldname, newname string) error {
+	if _, err := d.Lstat(newname); err == nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: os.ErrExist}
+	}
+	d.plan.add(DryRunOp{Op: "symlink", Path: oldname, NewPath: newname})
+	d.markCreated(newname, os.ModeSymlink|0777)
+	return nil
+}
+
+// Readlink reads a symbolic link of the base backend.
+func (d *DryRunFileSystem) Readlink(name string) (string, error) {
+	if _, created, gone := d.state(name); created || gone {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return d.base.Readlink(name)
+}
+
+// dryRunFile is a handle whose writes are only counted, in the size of the
+// plan entry at index op.
+type dryRunFile struct {
+	name   string
+	info   os.FileInfo
+	op     int
+	plan   *dryRunPlan
+	offset int64
+	closed bool
+}
+
+func (f *dryRunFile) Name() string { return f.name }
+
+func (f *dryRunFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	return 0, io.EOF
+}
+
+func (f *dryRunFile) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.op >= 0 {
+		f.plan.mu.Lock()
+		f.plan.ops[f.op].Size += int64(len(p))
+		f.plan.mu.Unlock()
+	}
+	f.offset += int64(len(p))
+	return len(p), nil
+}
+
+func (f *dryRunFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *dryRunFile) Close() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *dryRunFile) Stat() (os.FileInfo, error) { return f.info, nil }
+func (f *dryRunFile) Sync() error                { return nil }
+
+// dryRunInfo describes a path created in a dry run.
+type dryRunInfo struct {
+	name string
+	mode os.FileMode
+}
+
+func (i dryRunInfo) Name() string       { return i.name }
+func (i dryRunInfo) Size() int64        { return 0 }
+func (i dryRunInfo) Mode() os.FileMode  { return i.mode }
+func (i dryRunInfo) ModTime() time.Time { return time.Time{} }
+func (i dryRunInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i dryRunInfo) Sys() any           { return nil }
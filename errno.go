@@ -0,0 +1,28 @@
+//go:build !plan9
+
+package easyFS
+
+import (
+	"errors"
+	"syscall"
+)
+
+// System errors the backends report that plan9 does not define.
+var (
+	errLoop        error = syscall.ELOOP
+	errCrossDevice error = syscall.EXDEV
+	errNotEmpty    error = syscall.ENOTEMPTY
+	errReadOnly    error = syscall.EROFS
+	errBadFile     error = syscall.EBADF
+)
+
+// isCrossDevice tells whether a rename failed because the paths are on
+// different devices or backends.
+func isCrossDevice(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	// ERROR_NOT_SAME_DEVICE
+	return errno == syscall.EXDEV || IsWindows() && errno == 17
+}
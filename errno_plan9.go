@@ -0,0 +1,21 @@
+package easyFS
+
+import (
+	"errors"
+	"syscall"
+)
+
+// System errors the backends report that plan9 does not define.
+var (
+	errLoop        error = syscall.ErrorString("too many levels of symbolic links")
+	errCrossDevice error = syscall.ErrorString("cross-device link")
+	errNotEmpty    error = syscall.ErrorString("directory not empty")
+	errReadOnly    error = syscall.ErrorString("read-only file system")
+	errBadFile     error = syscall.ErrorString("bad file descriptor")
+)
+
+// isCrossDevice tells whether a rename failed because the paths are on
+// different backends.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errCrossDevice)
+}
@@ -0,0 +1,169 @@
+package easyFS
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Error kinds. KindOf classifies every error returned by the package as one
+// of them. ErrNotFound, ErrExist and ErrPermission are the io/fs errors, so
+// errors.Is matches them, and os.ErrNotExist and friends, against any error.
+// ErrIsDirectory and ErrNotDirectory only match an *Error that way: errors
+// of FileSystem methods and open handles used directly, such as their
+// *os.PathError, carry the system error and need KindOf.
+var (
+	ErrNotFound     = fs.ErrNotExist
+	ErrExist        = fs.ErrExist
+	ErrPermission   = fs.ErrPermission
+	ErrIsDirectory  = errors.New("easyFS: is a directory")
+	ErrNotDirectory = errors.New("easyFS: not a directory")
+)
+
+// Error records a failed operation on one path, or two for copies and moves.
+// The package reports failed file system operations as an *Error, wrapping
+// the error of the backend.
+// Besides the cause, errors.Is matches it against the kind of the cause, so
+// an Error caused by EISDIR is ErrIsDirectory too.
+//
+// Example:
+//
+//	_, err := NewFile("/etc").Read()
+//	var fsErr *Error
+//	if errors.As(err, &fsErr) && errors.Is(err, ErrIsDirectory) {
+//	    fmt.Println(fsErr.Op, fsErr.Path) // read /etc
+//	}
+type Error struct {
+	Op    string
+	Path  string
+	Path2 string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	s := e.Op + " " + e.Path
+	if e.Path2 != "" {
+		s += " " + e.Path2
+	}
+	return s + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of the cause.
+func (e *Error) Is(target error) bool {
+	kind := KindOf(e.Err)
+	return kind != nil && kind == target
+}
+
+// Kind returns the kind of the cause, see KindOf.
+func (e *Error) Kind() error {
+	return KindOf(e.Err)
+}
+
+// KindOf classifies err as ErrPathEscape, ErrIsDirectory, ErrNotDirectory,
+// ErrNotFound, ErrExist or ErrPermission, looking through wrapped and joined
+// errors and recognising the matching system errors. It returns nil for nil
+// and for errors of no known kind.
+//
+// Example:
+//
+//	switch KindOf(err) {
+//	case ErrNotFound:
+//	    // create it
+//	case ErrPermission:
+//	    // ask for access
+//	}
+func KindOf(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrPathEscape):
+		return ErrPathEscape
+	case errors.Is(err, ErrIsDirectory) || errors.Is(err, syscall.EISDIR):
+		return ErrIsDirectory
+	case errors.Is(err, ErrNotDirectory) || errors.Is(err, syscall.ENOTDIR):
+		return ErrNotDirectory
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNotFound
+	case errors.Is(err, fs.ErrExist):
+		return ErrExist
+	case errors.Is(err, fs.ErrPermission):
+		return ErrPermission
+	}
+	return nil
+}
+
+// MultiError holds every error of a recursive operation that carried on
+// after a failure, in the order they happened. errors.Is and errors.As look
+// at each of them.
+type MultiError struct {
+	Errs []error
+}
+
+func (m *MultiError) Error() string {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(len(m.Errs)) + " errors occurred:")
+	for _, err := range m.Errs {
+		b.WriteString("\n\t* " + err.Error())
+	}
+	return b.String()
+}
+
+func (m *MultiError) Unwrap() []error {
+	return m.Errs
+}
+
+// joinErrors returns nil for no errors, the only one as is, or a MultiError.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return &MultiError{Errs: errs}
+}
+
+// newError returns an Error for op on path, dropping the *os.PathError
+// around err, whose path would be repeated. An *Error is returned as is.
+func newError(op string, path PathHandler, err error) *Error {
+	switch e := err.(type) {
+	case *Error:
+		return e
+	case *os.PathError:
+		err = e.Err
+	}
+	return &Error{Op: op, Path: path.String(), Err: err}
+}
+
+// newLinkError is newError for an operation on two paths, dropping the
+// *os.LinkError or *os.PathError around err.
+func newLinkError(op string, oldpath, newpath PathHandler, err error) *Error {
+	switch e := err.(type) {
+	case *Error:
+		return e
+	case *os.LinkError:
+		err = e.Err
+	case *os.PathError:
+		err = e.Err
+	}
+	return &Error{Op: op, Path: oldpath.String(), Path2: newpath.String(), Err: err}
+}
+
+// checkFile returns an Error unless f exists and is not a directory.
+func (f File) checkFile(op string) error {
+	info, err := f.Stat()
+	if err != nil {
+		return newError(op, f.PathHandler, err)
+	}
+	if info.IsDir() {
+		return &Error{Op: op, Path: f.String(), Err: ErrIsDirectory}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package easyFS
 
 import (
 	"bufio"
+	"context"
 	"io"
 	"os"
 )
@@ -23,13 +24,16 @@ func NewFile(path PathHandler) File {
 
 // Size returns the size of the file in bytes.
 func (f File) Size() (int64, error) {
-	stat, err := os.Stat(f.String())
-	return stat.Size(), err
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
 }
 
 // Delete deletes the file.
 func (f File) Delete() error {
-	return os.Remove(f.String())
+	return remove(f.PathHandler)
 }
 
 // Copy copies the file to the specified destination directory.
@@ -40,38 +44,20 @@ func (f File) Delete() error {
 //	dest := NewDir("/path/to/destination")
 //	copiedFile, err := src.Copy(dest)
 func (f File) Copy(destDir Dir) (File, error) {
-	if f.Exists() && f.IsFile() {
-		srcFile, err := os.Open(f.String())
-		defer func() {
-			err := srcFile.Close()
-			if err != nil {
-				panic(err)
-			}
-		}()
-		if err != nil {
-			return File{}, err
-		}
-
-		err = destDir.CreateIfNotExist()
-		if err != nil {
-			return File{}, err
-		}
-
-		destFilePath := destDir.Join(f.Name())
-		destFile, err := os.Create(destFilePath.String())
-		if err != nil {
-			return File{}, err
-		}
-		defer destFile.Close()
-
-		_, err = io.Copy(destFile, srcFile)
-		if err != nil {
-			return File{}, err
-		}
+	return f.CopyContext(context.Background(), destDir)
+}
 
-		return destFilePath.File(), nil
-	}
-	return File{}, os.ErrNotExist
+// CopyContext is like Copy but stops as soon as ctx is cancelled. The
+// partial copy is discarded, leaving an existing destination file untouched,
+// and the returned error wraps ctx.Err() with the source path.
+//
+// Example:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+//	defer cancel()
+//	copiedFile, err := src.CopyContext(ctx, dest)
+func (f File) CopyContext(ctx context.Context, destDir Dir) (File, error) {
+	return f.CopyWith(ctx, destDir, CopyOptions{})
 }
 
 // Create creates the file. If the file already exists, it can overwrite it based on the 'overwrite' parameter.
@@ -89,11 +75,11 @@ func (f File) Create(overwrite bool) error {
 			return nil
 		}
 	}
-	file, err := os.Create(f.String())
-	if err == nil {
-		file.Close()
+	file, err := f.open(os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return newError("create", f.PathHandler, err)
 	}
-	return err
+	return file.Close()
 }
 
 // CreateIfNotExists creates the file if it does not exist already.
@@ -112,10 +98,10 @@ func (f File) CreateIfNotExists() error {
 //	file := NewFile(PathHandler("/path/to/file.txt"))
 //	data, err := file.Read()
 func (f File) Read() ([]byte, error) {
-	if f.Exists() && f.IsFile() {
-		return os.ReadFile(f.String())
+	if err := f.checkFile("read"); err != nil {
+		return nil, err
 	}
-	return nil, os.ErrNotExist
+	return readFile(f.PathHandler)
 }
 
 // ChunkReader returns a function to read the file in chunks of specified size.
@@ -138,24 +124,24 @@ func (f File) Read() ([]byte, error) {
 //	}
 //	err = closer()
 func (f File) ChunkReader(size int64) (func() ([]byte, error, bool), func() error, error) {
-	if f.Exists() && f.IsFile() {
-		file, err := os.Open(f.String())
-		if err != nil {
-			return nil, nil, err
-		}
-		return func() ([]byte, error, bool) {
-				data := make([]byte, size)
-				n, err := file.Read(data)
-				if err != nil {
-					file.Close()
-					return data, err, true
-				}
-				return data[:n], err, false
-			}, func() error {
-				return file.Close()
-			}, nil
+	if err := f.checkFile("read"); err != nil {
+		return nil, nil, err
+	}
+	file, err := f.open(os.O_RDONLY, 0)
+	if err != nil {
+		return nil, nil, err
 	}
-	return nil, nil, os.ErrNotExist
+	return func() ([]byte, error, bool) {
+			data := make([]byte, size)
+			n, err := file.Read(data)
+			if err != nil {
+				file.Close()
+				return data, err, true
+			}
+			return data[:n], err, false
+		}, func() error {
+			return file.Close()
+		}, nil
 }
 
 // ReadString reads the entire file and returns its content as a string.
@@ -187,21 +173,21 @@ func (f File) ReadString() (string, error) {
 //	file := NewFile(PathHandler("/path/to/file.txt"))
 //	iterator, err := file.IterateLine()
 func (f File) IterateLine() (func() (string, error), error) {
-	if f.Exists() && f.IsFile() {
-		file, err := os.Open(f.String())
+	if err := f.checkFile("read"); err != nil {
+		return nil, err
+	}
+	file, err := f.open(os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	return func() (string, error) {
+		line, err := reader.ReadString('\n')
 		if err != nil {
-			return nil, err
+			return line, err
 		}
-		reader := bufio.NewReader(file)
-		return func() (string, error) {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				return line, err
-			}
-			return line[:len(line)-1], nil
-		}, nil
-	}
-	return nil, os.ErrNotExist
+		return line[:len(line)-1], nil
+	}, nil
 }
 
 // Write writes the given data to the file.
@@ -217,7 +203,10 @@ func (f File) IterateLine() (func() (string, error), error) {
 //	file := NewFile(PathHandler("/path/to/file.txt"))
 //	err := file.Write([]byte("Hello, World!"))
 func (f File) Write(data []byte) error {
-	return os.WriteFile(f.String(), data, 0644)
+	if err := writeFile(f.PathHandler, data, 0644); err != nil {
+		return newError("write", f.PathHandler, err)
+	}
+	return nil
 }
 
 // WriteString writes the given string data to the file.
@@ -251,9 +240,9 @@ func (f File) WriteString(data string) error {
 //	err := file.AppendString("Hello, World!", true)
 func (f File) AppendString(data string, newLine bool) error {
 	// Open the file in append mode
-	file, err := os.OpenFile(f.String(), os.O_APPEND|os.O_WRONLY, 0644)
+	file, err := f.open(os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
-		return err
+		return newError("append", f.PathHandler, err)
 	}
 	defer file.Close()
 
@@ -263,9 +252,9 @@ func (f File) AppendString(data string, newLine bool) error {
 	}
 
 	// Write the data to the file
-	_, err = file.WriteString(data)
+	_, err = io.WriteString(file, data)
 	if err != nil {
-		return err
+		return newError("append", f.PathHandler, err)
 	}
 	return nil
 }
@@ -283,38 +272,45 @@ func (f File) AppendString(data string, newLine bool) error {
 //
 // appendNext([]byte("Hello, World!")
 func (f File) AppendIterative() (func(data []byte) error, error) {
-	// Open the file in append mode
-	file, err := os.OpenFile(f.String(), os.O_APPEND|os.O_WRONLY, 0644)
+	// Make sure the file can be opened in append mode
+	file, err := f.open(os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
-		return nil, err
+		return nil, newError("append", f.PathHandler, err)
 	}
-	defer file.Close()
+	file.Close()
 
 	return func(data []byte) error {
-		// Write the data to the file
-		_, err := file.Write(data)
-		if err != nil {
-			return err
-		}
-		return nil
+		return f.appendData(os.O_APPEND|os.O_WRONLY, data)
 	}, nil
 }
 
 // AppendStringIterative returns a function to iteratively append string data to the file.
 func (f *File) AppendStringIterative() (func(data string) error, error) {
-	// Open the file in append mode
-	file, err := os.OpenFile(f.String(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	// Make sure the file can be opened in append mode
+	file, err := f.open(os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return nil, err
+		return nil, newError("append", f.PathHandler, err)
 	}
-	defer file.Close()
+	file.Close()
 
+	target := *f
 	return func(data string) error {
-		// Write the data to the file
-		_, err := file.WriteString(data)
-		if err != nil {
-			return err
-		}
-		return nil
+		return target.appendData(os.O_APPEND|os.O_CREATE|os.O_WRONLY, []byte(data))
 	}, nil
 }
+
+// appendData opens the file with flag, writes data and closes it again.
+func (f File) appendData(flag int, data []byte) error {
+	file, err := f.open(flag, 0644)
+	if err != nil {
+		return newError("append", f.PathHandler, err)
+	}
+	_, err = file.Write(data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return newError("append", f.PathHandler, err)
+	}
+	return nil
+}
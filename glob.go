@@ -0,0 +1,236 @@
+package easyFS
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Pattern is a compiled double-star glob pattern. Compile it once with
+// CompilePattern and reuse it across calls.
+//
+// Syntax:
+//   - "*" matches any sequence of characters except "/".
+//   - "?" matches a single character except "/".
+//   - "[abc]", "[a-z]" and "[!a-z]" or "[^a-z]" match character classes.
+//   - "**" as a whole path segment matches zero or more directories.
+//   - "{a,b}" matches either alternative; braces may be nested.
+//   - A leading "!" negates the whole pattern.
+//   - "\" escapes the next character.
+//
+// A pattern without a "/" is matched against the base name, so "*.txt"
+// matches text files at any depth. Other patterns are matched against the
+// slash separated path relative to the directory being searched.
+type Pattern struct {
+	pattern      string
+	negate       bool
+	basename     bool
+	alternatives [][]string
+}
+
+// CompilePattern parses a double-star glob pattern.
+//
+// Example:
+//
+//	pattern, err := CompilePattern("src/**/*_test.go")
+//	matched := pattern.Match("src/pkg/file_test.go") // true
+func CompilePattern(pattern string) (*Pattern, error) {
+	p := &Pattern{pattern: pattern}
+	body := pattern
+	if strings.HasPrefix(body, "!") {
+		p.negate = true
+		body = body[1:]
+	}
+	expanded, err := expandBraces(body)
+	if err != nil {
+		return nil, err
+	}
+	p.basename = true
+	for _, alt := range expanded {
+		if strings.Contains(alt, "/") {
+			p.basename = false
+		}
+	}
+	for _, alt := range expanded {
+		alt = strings.TrimPrefix(alt, "/")
+		var segments []string
+		for _, segment := range strings.Split(alt, "/") {
+			if segment == "" {
+				continue
+			}
+			if segment != "**" {
+				if strings.Contains(segment, "**") {
+					segment = strings.ReplaceAll(segment, "**", "*")
+				}
+				segment = negateClasses(segment)
+				if _, err := path.Match(segment, ""); err != nil {
+					return nil, err
+				}
+			}
+			segments = append(segments, segment)
+		}
+		p.alternatives = append(p.alternatives, segments)
+	}
+	return p, nil
+}
+
+// MustCompilePattern is like CompilePattern but panics if the pattern is invalid.
+func MustCompilePattern(pattern string) *Pattern {
+	p, err := CompilePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source text of the pattern.
+func (p *Pattern) String() string {
+	return p.pattern
+}
+
+// Match reports whether the slash or host separated relative path name
+// matches the pattern.
+func (p *Pattern) Match(name string) bool {
+	name = strings.Trim(filepath.ToSlash(name), "/")
+	var segments []string
+	if name != "" {
+		segments = strings.Split(name, "/")
+	}
+	if p.basename && len(segments) > 0 {
+		segments = segments[len(segments)-1:]
+	}
+	matched := false
+	for _, alt := range p.alternatives {
+		if matchSegments(alt, segments) {
+			matched = true
+			break
+		}
+	}
+	return matched != p.negate
+}
+
+// matchSegments matches path segments, letting "**" consume any number of them.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i < len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// negateClasses rewrites the "[!" negated classes of a segment into the
+// "[^" form path.Match understands, leaving escapes and class members alone.
+func negateClasses(segment string) string {
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		switch segment[i] {
+		case '\\':
+			end := min(i+2, len(segment))
+			b.WriteString(segment[i:end])
+			i = end - 1
+		case '[':
+			end := classEnd(segment, i)
+			if end < 0 {
+				b.WriteString(segment[i:])
+				return b.String()
+			}
+			class := segment[i : end+1]
+			if strings.HasPrefix(class, "[!") {
+				class = "[^" + class[2:]
+			}
+			b.WriteString(class)
+			i = end
+		default:
+			b.WriteByte(segment[i])
+		}
+	}
+	return b.String()
+}
+
+// classEnd returns the index of the "]" closing the character class opened
+// at pattern[start], or -1 if the class is not closed.
+func classEnd(pattern string, start int) int {
+	for i := start + 1; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// expandBraces turns "a{b,c{d,e}}" into "ab", "acd" and "ace". Escaped
+// characters and character classes are copied as they are.
+func expandBraces(pattern string) ([]string, error) {
+	start, depth := -1, 0
+	var commas []int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			if end := classEnd(pattern, i); end >= 0 {
+				i = end
+			}
+		case '{':
+			if depth == 0 {
+				start = i
+				commas = commas[:0]
+			}
+			depth++
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		case '}':
+			if depth == 0 {
+				return nil, path.ErrBadPattern
+			}
+			depth--
+			if depth == 0 {
+				prefix, suffix := pattern[:start], pattern[i+1:]
+				var parts []string
+				last := start + 1
+				for _, comma := range commas {
+					parts = append(parts, pattern[last:comma])
+					last = comma + 1
+				}
+				parts = append(parts, pattern[last:i])
+				var expanded []string
+				for _, part := range parts {
+					alts, err := expandBraces(prefix + part + suffix)
+					if err != nil {
+						return nil, err
+					}
+					expanded = append(expanded, alts...)
+				}
+				return expanded, nil
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, path.ErrBadPattern
+	}
+	return []string{pattern}, nil
+}
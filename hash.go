@@ -0,0 +1,316 @@
+package easyFS
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// HashAlgorithm names a checksum algorithm supported by File.Hash.
+type HashAlgorithm string
+
+const (
+	SHA256     HashAlgorithm = "sha256"
+	SHA1       HashAlgorithm = "sha1"
+	MD5        HashAlgorithm = "md5"
+	BLAKE2b256 HashAlgorithm = "blake2b-256"
+	BLAKE2b512 HashAlgorithm = "blake2b-512"
+	// CRC32 is the IEEE polynomial used by zip, gzip and PNG.
+	CRC32 HashAlgorithm = "crc32"
+)
+
+// New returns a new hash.Hash for the algorithm.
+func (a HashAlgorithm) New() (hash.Hash, error) {
+	switch a {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case MD5:
+		return md5.New(), nil
+	case BLAKE2b256:
+		return newBlake2b(32), nil
+	case BLAKE2b512:
+		return newBlake2b(64), nil
+	case CRC32:
+		return crc32.NewIEEE(), nil
+	}
+	return nil, fmt.Errorf("easyFS: unknown hash algorithm %q", string(a))
+}
+
+// Hash returns the lowercase hex checksum of the file content. The file is
+// streamed through the hash, so it is never loaded into memory at once.
+//
+// Example:
+//
+//	file := NewFile("/path/to/file.iso")
+//	sum, err := file.Hash(SHA256)
+func (f File) Hash(algo HashAlgorithm) (string, error) {
+	return f.HashContext(context.Background(), algo)
+}
+
+// HashContext is like Hash but stops as soon as ctx is cancelled.
+func (f File) HashContext(ctx context.Context, algo HashAlgorithm) (string, error) {
+	h, err := algo.New()
+	if err != nil {
+		return "", err
+	}
+	file, err := f.open(os.O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, ctxReader{ctx, file}); err != nil {
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			return "", ctxErr(ctx, "hash", f.PathHandler)
+		}
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ManifestOptions controls Dir.WriteManifestWith and Dir.VerifyManifestWith.
+type ManifestOptions struct {
+	// Algorithm is the checksum algorithm. It defaults to SHA256.
+	Algorithm HashAlgorithm
+	// Ignore leaves ignored paths out of the manifest and out of the extra files.
+	Ignore *Ignore
+}
+
+// ManifestMismatch is a file whose checksum differs from the manifest.
+type ManifestMismatch struct {
+	Path     string
+	Expected string
+	// Actual is empty when the path is not a regular file.
+	Actual string
+}
+
+// ManifestReport is the result of verifying a manifest. Paths are slash
+// separated and relative to the verified directory.
+type ManifestReport struct {
+	// Matched lists the files whose checksum matches.
+	Matched []string
+	// Missing lists the files in the manifest that do not exist.
+	Missing []string
+	// Extra lists the files that exist but are not in the manifest.
+	Extra []string
+	// Mismatched lists the files whose checksum differs.
+	Mismatched []ManifestMismatch
+}
+
+// OK reports whether the directory matches the manifest exactly.
+func (r ManifestReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Mismatched) == 0
+}
+
+// WriteManifest writes the checksum of every regular file below the directory
+// to manifest in the format of sha256sum and similar tools, one
+// "<checksum>  <relative path>" line per file in lexical order. The manifest
+// itself is left out when it lives inside the directory, and it is written
+// atomically.
+//
+// Example:
+//
+//	dir := NewDir("/path/to/release")
+//	err := dir.WriteManifest(NewFile("/path/to/release/SHA256SUMS"), SHA256)
+//	// verify later with: cd /path/to/release && sha256sum -c SHA256SUMS
+func (d Dir) WriteManifest(manifest File, algo HashAlgorithm) error {
+	return d.WriteManifestWith(context.Background(), manifest, ManifestOptions{Algorithm: algo})
+}
+
+// WriteManifestWith is like WriteManifest but honours opts and stops as soon
+// as ctx is cancelled.
+func (d Dir) WriteManifestWith(ctx context.Context, manifest File, opts ManifestOptions) error {
+	algo := opts.algorithm()
+	if _, err := algo.New(); err != nil {
+		return err
+	}
+	files, err := d.manifestFiles(ctx, manifest, opts)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, rel := range files {
+		sum, err := d.Join(filepath.FromSlash(rel)).File().HashContext(ctx, algo)
+		if err != nil {
+			return err
+		}
+		b.WriteString(formatManifestLine(sum, rel))
+	}
+	return manifest.WriteStringAtomic(b.String())
+}
+
+// VerifyManifest checks the directory against a manifest written by
+// WriteManifest or sha256sum. Both the text ("  ") and binary (" *") line
+// forms are accepted. The returned error is only set when the manifest cannot
+// be read or parsed, or a file cannot be hashed; differences are reported in
+// the ManifestReport. A manifest listing a path outside the directory, such
+// as one starting with "../", is rejected with ErrPathEscape. Symbolic links
+// are not followed: an entry naming one, or a path through one, is reported
+// as mismatched, since WriteManifest only lists regular files.
+//
+// Example:
+//
+//	report, err := dir.VerifyManifest(NewFile("/path/to/release/SHA256SUMS"), SHA256)
+//	if err == nil && !report.OK() {
+//	    fmt.Println("missing:", report.Missing, "changed:", report.Mismatched)
+//	}
+func (d Dir) VerifyManifest(manifest File, algo HashAlgorithm) (ManifestReport, error) {
+	return d.VerifyManifestWith(context.Background(), manifest, ManifestOptions{Algorithm: algo})
+}
+
+// VerifyManifestWith is like VerifyManifest but honours opts and stops as
+// soon as ctx is cancelled.
+func (d Dir) VerifyManifestWith(ctx context.Context, manifest File, opts ManifestOptions) (ManifestReport, error) {
+	var report ManifestReport
+	algo := opts.algorithm()
+	h, err := algo.New()
+	if err != nil {
+		return report, err
+	}
+	entries, err := readManifest(manifest, h.Size()*2)
+	if err != nil {
+		return report, err
+	}
+	listed := map[string]bool{}
+	for _, entry := range entries {
+		listed[entry.path] = true
+		file := d.Join(filepath.FromSlash(entry.path)).File()
+		info, err := d.lstatBelow(entry.path)
+		switch {
+		case err != nil || info.IsDir():
+			report.Missing = append(report.Missing, entry.path)
+			continue
+		case !info.Mode().IsRegular():
+			report.Mismatched = append(report.Mismatched, ManifestMismatch{Path: entry.path, Expected: entry.sum})
+			continue
+		}
+		sum, err := file.HashContext(ctx, algo)
+		if err != nil {
+			return report, err
+		}
+		if sum == entry.sum {
+			report.Matched = append(report.Matched, entry.path)
+		} else {
+			report.Mismatched = append(report.Mismatched, ManifestMismatch{Path: entry.path, Expected: entry.sum, Actual: sum})
+		}
+	}
+	files, err := d.manifestFiles(ctx, manifest, opts)
+	if err != nil {
+		return report, err
+	}
+	for _, rel := range files {
+		if !listed[rel] {
+			report.Extra = append(report.Extra, rel)
+		}
+	}
+	return report, nil
+}
+
+// lstatBelow returns information about the slash separated path rel below
+// the directory without following symbolic links. When a parent of it is a
+// link, that link is described instead.
+func (d Dir) lstatBelow(rel string) (PathInfo, error) {
+	p := d.PathHandler
+	var info PathInfo
+	for _, name := range strings.Split(rel, "/") {
+		p = p.Join(name)
+		var err error
+		if info, err = p.Lstat(); err != nil {
+			return nil, err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return info, nil
+		}
+	}
+	return info, nil
+}
+
+func (opts ManifestOptions) algorithm() HashAlgorithm {
+	if opts.Algorithm == "" {
+		return SHA256
+	}
+	return opts.Algorithm
+}
+
+// manifestFiles lists the regular files below the directory, relative and
+// slash separated, leaving out the manifest itself.
+func (d Dir) manifestFiles(ctx context.Context, manifest File, opts ManifestOptions) ([]string, error) {
+	var files []string
+	err := d.WalkContext(ctx, WalkOptions{Ignore: opts.Ignore}, func(entry WalkEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Entry.Type().IsRegular() && filepath.Clean(entry.Path.String()) != filepath.Clean(manifest.String()) {
+			files = append(files, d.slashRel(entry.Path))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+type manifestEntry struct {
+	sum  string
+	path string
+}
+
+// readManifest parses sha256sum style lines, checking that every checksum
+// has sumLen hex digits and that every path stays inside the directory.
+func readManifest(manifest File, sumLen int) ([]manifestEntry, error) {
+	file, err := manifest.open(os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []manifestEntry
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		escaped := strings.HasPrefix(line, `\`)
+		if escaped {
+			line = line[1:]
+		}
+		if len(line) < sumLen+2 || line[sumLen] != ' ' || (line[sumLen+1] != ' ' && line[sumLen+1] != '*') {
+			return nil, &Error{Op: "read manifest", Path: manifest.String(), Err: fmt.Errorf("line %d: malformed checksum line", n)}
+		}
+		sum := strings.ToLower(line[:sumLen])
+		if _, err := hex.DecodeString(sum); err != nil {
+			return nil, &Error{Op: "read manifest", Path: manifest.String(), Err: fmt.Errorf("line %d: malformed checksum", n)}
+		}
+		name := line[sumLen+2:]
+		if escaped {
+			name = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(name)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			// a crafted manifest must not make us hash files outside the directory
+			return nil, &Error{Op: "read manifest", Path: manifest.String(), Err: fmt.Errorf("line %d: %q: %w", n, name, ErrPathEscape)}
+		}
+		entries = append(entries, manifestEntry{sum: sum, path: strings.TrimPrefix(filepath.ToSlash(filepath.Clean(name)), "./")})
+	}
+	return entries, scanner.Err()
+}
+
+// formatManifestLine formats a line like sha256sum does, escaping names that
+// contain a backslash or a newline.
+func formatManifestLine(sum, name string) string {
+	if strings.ContainsAny(name, "\\\n") {
+		return `\` + sum + "  " + strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(name) + "\n"
+	}
+	return sum + "  " + name + "\n"
+}
@@ -0,0 +1,213 @@
+package easyFS
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Ignore decides which paths below a root directory are ignored, following
+// gitignore rules: nested ignore files, "!" negation, directory-only rules
+// ending in "/", patterns anchored by a "/" and "**" wildcards. A path inside
+// an ignored directory is always ignored.
+//
+// Attach it to WalkOptions, FindOptions or CopyOptions to skip ignored paths
+// entirely. Ignore files are read lazily through the backend and cached, and
+// an Ignore is safe for concurrent use.
+type Ignore struct {
+	root      Dir
+	fileNames []string
+	anchored  bool
+
+	mu     sync.Mutex
+	rules  map[string][]ignoreRule
+	loaded map[string]bool
+}
+
+type ignoreRule struct {
+	pattern      *Pattern
+	self         *Pattern
+	negate       bool
+	dirOnly      bool
+	contentsOnly bool
+}
+
+// NewIgnore creates an Ignore for root that reads the named ignore files from
+// every directory it looks at.
+//
+// Example:
+//
+//	ignore := NewIgnore(dir, ".gitignore")
+//	paths, err := dir.FindWith(ctx, MustCompilePattern("*.go"), FindOptions{WalkOptions: WalkOptions{Ignore: ignore}})
+func NewIgnore(root Dir, fileNames ...string) *Ignore {
+	return &Ignore{
+		root:      root,
+		fileNames: fileNames,
+		rules:     map[string][]ignoreRule{},
+		loaded:    map[string]bool{},
+	}
+}
+
+// GitIgnore creates an Ignore that honours the .gitignore files of root and
+// its subdirectories.
+func GitIgnore(root Dir) *Ignore {
+	return NewIgnore(root, ".gitignore")
+}
+
+// DockerIgnore creates an Ignore from the .dockerignore file in root. Like
+// Docker, every pattern is matched relative to root and nested ignore files
+// are not read.
+func DockerIgnore(root Dir) *Ignore {
+	i := NewIgnore(root)
+	i.anchored = true
+	if data, err := readFile(root.Join(".dockerignore")); err == nil {
+		i.AddPatterns("", strings.Split(string(data), "\n")...)
+	}
+	return i
+}
+
+// AddPatterns adds gitignore style lines for the directory base, given
+// relative to the root ("" for the root itself).
+//
+// Example:
+//
+//	ignore := GitIgnore(dir)
+//	ignore.AddPatterns("", "node_modules/", "*.log", "!important.log")
+func (i *Ignore) AddPatterns(base string, lines ...string) {
+	base = cleanRel(base)
+	rules := parseIgnore(lines, i.anchored)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rules[base] = append(i.rules[base], rules...)
+}
+
+// Match reports whether p is ignored. isDir tells whether p is a directory,
+// which directory-only rules depend on. Paths outside the root are never
+// ignored.
+func (i *Ignore) Match(p PathHandler, isDir bool) bool {
+	if i == nil {
+		return false
+	}
+	rel, err := filepath.Rel(i.root.String(), p.String())
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for n := 1; n < len(parts); n++ {
+		if i.matchSelf(parts[:n], true) {
+			return true
+		}
+	}
+	return i.matchSelf(parts, isDir)
+}
+
+// matchSelf applies the rules of every directory from the root down to the
+// parent of the path, letting the last matching rule win.
+func (i *Ignore) matchSelf(parts []string, isDir bool) bool {
+	ignored := false
+	for depth := 0; depth < len(parts); depth++ {
+		base := strings.Join(parts[:depth], "/")
+		rel := strings.Join(parts[depth:], "/")
+		for _, rule := range i.rulesFor(base) {
+			if rule.match(rel, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// rulesFor returns the rules of the directory base, loading its ignore files
+// on first use.
+func (i *Ignore) rulesFor(base string) []ignoreRule {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.loaded[base] {
+		i.loaded[base] = true
+		dir := i.root.PathHandler
+		if base != "" {
+			dir = dir.Join(filepath.FromSlash(base))
+		}
+		for _, name := range i.fileNames {
+			data, err := readFile(dir.Join(name))
+			if err != nil {
+				// a missing or unreadable ignore file adds no rules
+				continue
+			}
+			i.rules[base] = append(i.rules[base], parseIgnore(strings.Split(string(data), "\n"), i.anchored)...)
+		}
+	}
+	return i.rules[base]
+}
+
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.contentsOnly && r.self.Match(rel) {
+		return false
+	}
+	return r.pattern.Match(rel)
+}
+
+// parseIgnore parses gitignore lines into rules.
+func parseIgnore(lines []string, anchored bool) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		line = trimIgnoreSpaces(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if anchored || strings.Contains(line, "/") {
+			line = "/" + strings.TrimPrefix(line, "/")
+		}
+		// braces have no special meaning in ignore files
+		line = strings.NewReplacer("{", `\{`, "}", `\}`).Replace(line)
+		pattern, err := CompilePattern(line)
+		if err != nil {
+			continue
+		}
+		rule.pattern = pattern
+		if strings.HasSuffix(line, "/**") {
+			rule.contentsOnly = true
+			rule.self, _ = CompilePattern(strings.TrimSuffix(line, "/**"))
+			if rule.self == nil {
+				rule.contentsOnly = false
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// trimIgnoreSpaces removes trailing spaces unless they are escaped with "\".
+// Escapes such as "\ ", "\#" and "\!" are kept for the pattern matcher.
+func trimIgnoreSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// cleanRel normalises a relative directory to the slash form used as a rules key.
+func cleanRel(rel string) string {
+	rel = strings.Trim(filepath.ToSlash(filepath.Clean(rel)), "/")
+	if rel == "." {
+		return ""
+	}
+	return rel
+}
@@ -0,0 +1,303 @@
+package easyFS
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// FS returns the directory as an io/fs file system, so it can be passed to
+// anything in the standard library that accepts an fs.FS. The result also
+// implements fs.ReadDirFS, fs.StatFS, fs.ReadFileFS and fs.GlobFS.
+//
+// Example:
+//
+//	dir := NewDir("/path/to/templates")
+//	tmpl, err := template.ParseFS(dir.FS(), "*.html")
+func (d Dir) FS() fs.FS {
+	return dirFS{d}
+}
+
+// dirFS serves a Dir through the io/fs interfaces.
+type dirFS struct {
+	root Dir
+}
+
+// path converts a slash separated fs.FS name to a path below the root.
+func (d dirFS) path(op, name string) (PathHandler, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return d.root.PathHandler, nil
+	}
+	return d.root.Join(filepath.FromSlash(name)), nil
+}
+
+// fsError rewrites backend errors so they report the fs.FS name.
+func fsError(op, name string, err error) error {
+	var pathErr *fs.PathError
+	var fsErr *Error
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	} else if errors.As(err, &fsErr) {
+		err = fsErr.Err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (d dirFS) Open(name string) (fs.File, error) {
+	p, err := d.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := p.open(os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fsError("open", name, err)
+	}
+	info, err := handle.Stat()
+	if err != nil {
+		handle.Close()
+		return nil, fsError("open", name, err)
+	}
+	file := &fsFile{FileHandle: handle, name: name, info: fsFileInfo{info, name}}
+	if info.IsDir() {
+		return &fsDirFile{fsFile: file, path: p}, nil
+	}
+	return file, nil
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := d.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := p.Stat()
+	if err != nil {
+		return nil, fsError("stat", name, err)
+	}
+	return fsFileInfo{info, name}, nil
+}
+
+func (d dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := d.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := p.FileSystem().ReadDir(p.String())
+	if err != nil {
+		return nil, fsError("readdir", name, err)
+	}
+	return entries, nil
+}
+
+func (d dirFS) ReadFile(name string) ([]byte, error) {
+	p, err := d.path("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readFile(p)
+	if err != nil {
+		return nil, fsError("readfile", name, err)
+	}
+	return data, nil
+}
+
+func (d dirFS) Glob(pattern string) ([]string, error) {
+	// Hide the Glob method so fs.Glob falls back to walking with ReadDir.
+	return fs.Glob(struct{ fs.ReadDirFS }{d}, pattern)
+}
+
+// fsFileInfo reports the fs.FS base name, which is "." for the root.
+type fsFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i fsFileInfo) Name() string {
+	if i.name == "." {
+		return i.FileInfo.Name()
+	}
+	return filepath.Base(filepath.FromSlash(i.name))
+}
+
+// fsFile is a regular file opened through dirFS.
+type fsFile struct {
+	FileHandle
+	name string
+	info fs.FileInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// fsDirFile is a directory opened through dirFS.
+type fsDirFile struct {
+	*fsFile
+	path    PathHandler
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (f *fsDirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+}
+
+func (f *fsDirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.read {
+		entries, err := f.path.FileSystem().ReadDir(f.path.String())
+		if err != nil {
+			return nil, fsError("readdir", f.name, err)
+		}
+		f.entries, f.read = entries, true
+	}
+	if n <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(f.entries) {
+		n = len(f.entries)
+	}
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+// IOFileSystem is a read-only FileSystem backend serving an fs.FS, such as an
+// embed.FS or a *zip.Reader, as the tree mounted at Root.
+type IOFileSystem struct {
+	FS   fs.FS
+	Root PathHandler
+}
+
+var fsMountCount atomic.Int64
+
+// FromFS mounts fsys read-only at a unique virtual root and returns it as a Dir.
+// The mount stays in place until it is removed with Unmount.
+//
+// Example:
+//
+//	//go:embed assets
+//	var assets embed.FS
+//	dir := FromFS(assets)
+//	data, err := dir.Join("assets", "style.css").File().Read()
+func FromFS(fsys fs.FS) Dir {
+	root := PathHandler(fmt.Sprintf("%ceasyfs-fs-%d", os.PathSeparator, fsMountCount.Add(1)))
+	return MountFS(root, fsys)
+}
+
+// MountFS mounts fsys read-only at root and returns root as a Dir.
+func MountFS(root PathHandler, fsys fs.FS) Dir {
+	root = PathHandler(filepath.Clean(root.String()))
+	Mount(root, &IOFileSystem{FS: fsys, Root: root})
+	return root.Dir()
+}
+
+// rel converts a path below Root to an fs.FS name.
+func (i *IOFileSystem) rel(op, name string) (string, error) {
+	rel, err := filepath.Rel(i.Root.String(), filepath.Clean(name))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func (i *IOFileSystem) readOnly(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: errReadOnly}
+}
+
+func (i *IOFileSystem) OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, i.readOnly("open", name)
+	}
+	rel, err := i.rel("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := i.FS.Open(rel)
+	if err != nil {
+		return nil, err
+	}
+	return &ioHandle{File: file, name: name}, nil
+}
+
+func (i *IOFileSystem) Stat(name string) (os.FileInfo, error) {
+	rel, err := i.rel("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(i.FS, rel)
+}
+
+// Lstat is the same as Stat, since fs.FS has no notion of symbolic links.
+func (i *IOFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return i.Stat(name)
+}
+
+func (i *IOFileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	rel, err := i.rel("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(i.FS, rel)
+}
+
+func (i *IOFileSystem) Mkdir(name string, perm os.FileMode) error {
+	return i.readOnly("mkdir", name)
+}
+
+func (i *IOFileSystem) Remove(name string) error {
+	return i.readOnly("remove", name)
+}
+
+func (i *IOFileSystem) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errReadOnly}
+}
+
+func (i *IOFileSystem) Chmod(name string, mode os.FileMode) error {
+	return i.readOnly("chmod", name)
+}
+
+func (i *IOFileSystem) Symlink(oldname, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: errReadOnly}
+}
+
+func (i *IOFileSystem) Readlink(name string) (string, error) {
+	return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+}
+
+// ioHandle adapts an fs.File to FileHandle.
+type ioHandle struct {
+	fs.File
+	name string
+}
+
+func (h *ioHandle) Name() string {
+	return h.name
+}
+
+func (h *ioHandle) Write([]byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: h.name, Err: errReadOnly}
+}
+
+func (h *ioHandle) Seek(offset int64, whence int) (int64, error) {
+	if seeker, ok := h.File.(io.Seeker); ok {
+		return seeker.Seek(offset, whence)
+	}
+	return 0, &os.PathError{Op: "seek", Path: h.name, Err: errors.ErrUnsupported}
+}
+
+func (h *ioHandle) Sync() error {
+	return nil
+}
@@ -0,0 +1,145 @@
+package easyFS
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+)
+
+// ReadJSON decodes the JSON file into a value of type T, streaming the file
+// through the decoder.
+//
+// Example:
+//
+//	type Config struct {
+//	    Port int    `json:"port"`
+//	    Host string `json:"host"`
+//	}
+//	config, err := ReadJSON[Config](NewFile("/etc/app/config.json"))
+func ReadJSON[T any](f File) (T, error) {
+	var value T
+	file, err := f.open(os.O_RDONLY, 0)
+	if err != nil {
+		return value, err
+	}
+	defer file.Close()
+	if err := json.NewDecoder(bufio.NewReader(file)).Decode(&value); err != nil {
+		return value, &Error{Op: "decode json", Path: f.String(), Err: err}
+	}
+	return value, nil
+}
+
+// WriteJSON encodes v as indented JSON and writes it to the file atomically,
+// so readers never see a half written document.
+//
+// Example:
+//
+//	err := WriteJSON(NewFile("/etc/app/config.json"), config)
+func WriteJSON(f File, v any) error {
+	w, err := f.CreateAtomic()
+	if err != nil {
+		return err
+	}
+	defer w.Abort()
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return &Error{Op: "encode json", Path: f.String(), Err: err}
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	return w.Commit()
+}
+
+// AppendJSONLine appends v to the JSON Lines file as a single line, creating
+// the file if needed. The line is written with one call, so concurrent
+// appenders do not interleave their records.
+//
+// Example:
+//
+//	err := AppendJSONLine(NewFile("/var/log/app/events.jsonl"), Event{Name: "login", User: "ana"})
+func AppendJSONLine(f File, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return &Error{Op: "encode json", Path: f.String(), Err: err}
+	}
+	return f.appendData(os.O_APPEND|os.O_CREATE|os.O_WRONLY, append(data, '\n'))
+}
+
+// WriteJSONLines replaces the content of the file with one JSON line per
+// record. Like WriteJSON it writes atomically, so when a record fails to
+// encode the file keeps its previous content.
+//
+// Example:
+//
+//	err := WriteJSONLines(NewFile("/path/to/users.jsonl"), slices.Values(users))
+func WriteJSONLines[T any](f File, records iter.Seq[T]) error {
+	w, err := f.CreateAtomic()
+	if err != nil {
+		return err
+	}
+	defer w.Abort()
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	for record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return &Error{Op: "encode json", Path: f.String(), Err: err}
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	return w.Commit()
+}
+
+// IterateJSONLines returns an iterator over the records of the JSON Lines
+// file, decoding one line at a time. Blank lines are skipped. A line that
+// cannot be decoded is yielded with an error naming its line number, after
+// which the iteration stops.
+//
+// Example:
+//
+//	for event, err := range IterateJSONLines[Event](NewFile("/var/log/app/events.jsonl")) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(event.Name)
+//	}
+func IterateJSONLines[T any](f File) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		file, err := f.open(os.O_RDONLY, 0)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer file.Close()
+		reader := bufio.NewReader(file)
+		for n := 1; ; n++ {
+			line, err := reader.ReadBytes('\n')
+			if err != nil && err != io.EOF {
+				yield(zero, err)
+				return
+			}
+			if len(bytes.TrimSpace(line)) > 0 {
+				var record T
+				if jerr := json.Unmarshal(line, &record); jerr != nil {
+					yield(zero, &Error{Op: "decode json", Path: f.String(), Err: fmt.Errorf("line %d: %w", n, jerr)})
+					return
+				}
+				if !yield(record, nil) {
+					return
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+		}
+	}
+}
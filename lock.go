@@ -0,0 +1,322 @@
+package easyFS
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned by the TryLock methods when the lock is held elsewhere.
+var ErrLocked = errors.New("easyFS: lock is held by another owner")
+
+// lockPollInterval is how often the context variants retry a busy lock.
+const lockPollInterval = 25 * time.Millisecond
+
+// FileLock is an advisory lock held on a file. Other processes using the
+// File lock methods on the same file are excluded until Unlock is called.
+// Locks are flock based on Unix and LockFileEx based on Windows, and only
+// work on the OS backend.
+type FileLock struct {
+	path PathHandler
+	file FileHandle
+}
+
+type fdHandle interface {
+	Fd() uintptr
+}
+
+// Lock acquires an exclusive lock on the file, waiting until it is available.
+// The file is created if it does not exist.
+//
+// Example:
+//
+//	lock, err := file.Lock()
+//	if err != nil {
+//	    return err
+//	}
+//	defer lock.Unlock()
+//	err = file.AppendString("entry", true)
+func (f File) Lock() (*FileLock, error) {
+	return f.lock(false, true)
+}
+
+// RLock acquires a shared lock on the file, waiting until no exclusive lock
+// is held. Any number of shared locks can be held at once.
+func (f File) RLock() (*FileLock, error) {
+	return f.lock(true, true)
+}
+
+// TryLock acquires an exclusive lock on the file without waiting. It fails
+// with ErrLocked if the lock is held elsewhere.
+func (f File) TryLock() (*FileLock, error) {
+	return f.lock(false, false)
+}
+
+// TryRLock acquires a shared lock on the file without waiting. It fails with
+// ErrLocked if an exclusive lock is held elsewhere.
+func (f File) TryRLock() (*FileLock, error) {
+	return f.lock(true, false)
+}
+
+// LockContext acquires an exclusive, or with shared a shared, lock on the
+// file, retrying until ctx is done.
+//
+// Example:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//	defer cancel()
+//	lock, err := file.LockContext(ctx, false)
+func (f File) LockContext(ctx context.Context, shared bool) (*FileLock, error) {
+	for {
+		lock, err := f.lock(shared, false)
+		if !errors.Is(err, ErrLocked) {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctxErr(ctx, "lock", f.PathHandler)
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// WithLock runs fn while holding an exclusive lock on the file.
+//
+// Example:
+//
+//	err := file.WithLock(func() error {
+//	    return file.AppendString("entry", true)
+//	})
+func (f File) WithLock(fn func() error) error {
+	lock, err := f.Lock()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	if uerr := lock.Unlock(); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+func (f File) lock(shared, block bool) (*FileLock, error) {
+	file, err := f.open(os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil && errors.Is(err, os.ErrPermission) {
+		file, err = f.open(os.O_RDONLY, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fd, ok := file.(fdHandle)
+	if !ok {
+		file.Close()
+		return nil, &Error{Op: "lock", Path: f.String(), Err: errors.ErrUnsupported}
+	}
+	if err := lockHandle(fd.Fd(), shared, block); err != nil {
+		file.Close()
+		if err == ErrLocked {
+			return nil, &Error{Op: "lock", Path: f.String(), Err: ErrLocked}
+		}
+		return nil, &Error{Op: "lock", Path: f.String(), Err: err}
+	}
+	return &FileLock{path: f.PathHandler, file: file}, nil
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	if l.file == nil {
+		return &Error{Op: "unlock", Path: l.path.String(), Err: os.ErrClosed}
+	}
+	err := unlockHandle(l.file.(fdHandle).Fd())
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	return err
+}
+
+// LockFile is a lock represented by a sidecar file holding the owner's PID.
+// Unlike FileLock it works for directories and on every backend. A lock whose
+// owner process no longer runs is considered stale and is taken over.
+type LockFile struct {
+	path PathHandler
+	// token tells this lock apart from others taken by the same process
+	token string
+	held  bool
+}
+
+// LockFile returns the sidecar lock for the path, stored next to it with a
+// ".lock" suffix.
+//
+// Example:
+//
+//	lock := dir.LockFile()
+//	if err := lock.TryLock(); err != nil {
+//	    return err
+//	}
+//	defer lock.Unlock()
+func (p PathHandler) LockFile() *LockFile {
+	return &LockFile{path: PathHandler(p.String() + ".lock"), token: strconv.FormatUint(rand.Uint64(), 36)}
+}
+
+// Path returns the path of the sidecar file.
+func (l *LockFile) Path() PathHandler {
+	return l.path
+}
+
+// content is what the sidecar holds while l is held: the PID and the token.
+func (l *LockFile) content() []byte {
+	return []byte(strconv.Itoa(os.Getpid()) + " " + l.token + "\n")
+}
+
+// TryLock acquires the lock without waiting. It fails with ErrLocked if a
+// running process holds it.
+//
+// The sidecar is published atomically, complete with its content. A stale
+// one is replaced while holding a second ".takeover" sidecar, after checking
+// that it is still the same stale lock, so that of several processes finding
+// it only one takes it over.
+func (l *LockFile) TryLock() error {
+	for attempt := 0; attempt < 3; attempt++ {
+		err := l.path.File().writeAtomic(l.content(), true)
+		if err == nil {
+			l.held = true
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+		data, err := readFile(l.path)
+		if errors.Is(err, os.ErrNotExist) {
+			// released in the meantime
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !staleLock(l.path, data) {
+			break
+		}
+		err = l.takeOver(data)
+		if err == nil {
+			l.held = true
+			return nil
+		}
+		if !errors.Is(err, errRetryLock) {
+			return err
+		}
+	}
+	return &Error{Op: "lock", Path: l.path.String(), Err: ErrLocked}
+}
+
+// errRetryLock makes TryLock try again after a takeover gave way.
+var errRetryLock = errors.New("easyFS: retry lock")
+
+// takeOver replaces the stale sidecar holding stale with l's.
+func (l *LockFile) takeOver(stale []byte) error {
+	guard := PathHandler(l.path.String() + ".takeover")
+	if err := guard.File().writeAtomic(l.content(), true); err != nil {
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+		// another takeover is running, or crashed and left its guard behind
+		if data, err := readFile(guard); err == nil && staleLock(guard, data) {
+			removeIfContent(guard, data)
+			return errRetryLock
+		}
+		return &Error{Op: "lock", Path: l.path.String(), Err: ErrLocked}
+	}
+	defer removeIfContent(guard, l.content())
+	current, err := readFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return errRetryLock
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, stale) {
+		// taken over or released and locked again before we got the guard
+		return &Error{Op: "lock", Path: l.path.String(), Err: ErrLocked}
+	}
+	if err := l.path.File().writeAtomic(l.content(), false); err != nil {
+		return err
+	}
+	if current, err := readFile(l.path); err != nil || !bytes.Equal(current, l.content()) {
+		return &Error{Op: "lock", Path: l.path.String(), Err: ErrLocked}
+	}
+	return nil
+}
+
+// staleLock reports whether the sidecar p holding data belongs to a process
+// that no longer runs.
+func staleLock(p PathHandler, data []byte) bool {
+	pid, err := parseOwner(data)
+	if err == nil {
+		return !processAlive(pid)
+	}
+	// the owner may still be writing its PID on backends that cannot link
+	info, err := p.Stat()
+	return err == nil && time.Since(info.ModTime()) >= time.Second
+}
+
+// removeIfContent removes the file p if it still holds data.
+func removeIfContent(p PathHandler, data []byte) error {
+	current, err := readFile(p)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, data) {
+		return &Error{Op: "unlock", Path: p.String(), Err: ErrLocked}
+	}
+	return remove(p)
+}
+
+// Lock acquires the lock, retrying until ctx is done.
+func (l *LockFile) Lock(ctx context.Context) error {
+	for {
+		err := l.TryLock()
+		if !errors.Is(err, ErrLocked) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctxErr(ctx, "lock", l.path)
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Unlock releases the lock by removing the sidecar file. A sidecar that no
+// longer holds this lock's PID and token, because the lock was taken over,
+// is left alone and Unlock fails with ErrLocked.
+func (l *LockFile) Unlock() error {
+	if !l.held {
+		return &Error{Op: "unlock", Path: l.path.String(), Err: os.ErrClosed}
+	}
+	l.held = false
+	return removeIfContent(l.path, l.content())
+}
+
+// Owner returns the PID recorded in the sidecar file.
+func (l *LockFile) Owner() (int, error) {
+	data, err := readFile(l.path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := parseOwner(data)
+	if err != nil {
+		return 0, &Error{Op: "lock", Path: l.path.String(), Err: err}
+	}
+	return pid, nil
+}
+
+// parseOwner returns the PID at the start of a sidecar's content.
+func parseOwner(data []byte) (int, error) {
+	pid, _, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+	return strconv.Atoi(pid)
+}
@@ -0,0 +1,18 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package easyFS
+
+import "errors"
+
+func lockHandle(fd uintptr, shared, block bool) error {
+	return errors.ErrUnsupported
+}
+
+func unlockHandle(fd uintptr) error {
+	return errors.ErrUnsupported
+}
+
+// processAlive assumes the owner is running where it cannot be checked.
+func processAlive(pid int) bool {
+	return pid > 0
+}
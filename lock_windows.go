@@ -0,0 +1,74 @@
+//go:build windows
+
+package easyFS
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+	errorInvalidParameter   = syscall.Errno(87)
+	stillActive             = 259
+)
+
+// lockOverlapped returns the position of the locked byte. Windows byte range
+// locks are mandatory, so the lock is placed far past any data, where it
+// does not stop other handles from reading and writing the file.
+func lockOverlapped() *syscall.Overlapped {
+	return &syscall.Overlapped{Offset: 0xFFFFFFFF, OffsetHigh: 0xFFFFFFFF}
+}
+
+func lockHandle(fd uintptr, shared, block bool) error {
+	var flags uintptr
+	if !shared {
+		flags |= lockfileExclusiveLock
+	}
+	if !block {
+		flags |= lockfileFailImmediately
+	}
+	r, _, err := procLockFileEx.Call(fd, flags, 0, 1, 0, uintptr(unsafe.Pointer(lockOverlapped())))
+	if r == 0 {
+		if err == errorLockViolation {
+			return ErrLocked
+		}
+		return err
+	}
+	return nil
+}
+
+func unlockHandle(fd uintptr) error {
+	r, _, err := procUnlockFileEx.Call(fd, 0, 1, 0, uintptr(unsafe.Pointer(lockOverlapped())))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// processAlive reports whether a process with the given PID is running.
+// Like EPERM on Unix, being denied access to the process means it exists;
+// only ERROR_INVALID_PARAMETER says there is no such process.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return err != errorInvalidParameter
+	}
+	defer syscall.CloseHandle(handle)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
@@ -0,0 +1,552 @@
+package easyFS
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxSymlinkHops bounds symbolic link resolution, like ELOOP on Linux.
+const maxSymlinkHops = 40
+
+// MemFileSystem is a FileSystem kept entirely in memory. It is safe for
+// concurrent use, so parallel tests can share one instance.
+//
+// Paths are cleaned and treated as relative to the in-memory root, so
+// "/a/b", "a/b" and "a/./b" all name the same entry. Modes are stored as
+// given; no umask is applied.
+//
+// Example:
+//
+//	mem := NewMemFileSystem()
+//	Mount("/mem", mem)
+//	defer Unmount("/mem")
+//	file, err := NewDir("/mem/project").CreateFileWithData("a.txt", []byte("hi"), true)
+type MemFileSystem struct {
+	mu   sync.RWMutex
+	root *memNode
+}
+
+type memNode struct {
+	name     string
+	mode     os.FileMode
+	modTime  time.Time
+	data     []byte
+	target   string
+	children map[string]*memNode
+}
+
+func (n *memNode) isDir() bool {
+	return n.mode.IsDir()
+}
+
+func (n *memNode) isSymlink() bool {
+	return n.mode&os.ModeSymlink != 0
+}
+
+func (n *memNode) info() os.FileInfo {
+	size := int64(len(n.data))
+	if n.isSymlink() {
+		size = int64(len(n.target))
+	}
+	return memFileInfo{name: n.name, size: size, mode: n.mode, modTime: n.modTime, node: n}
+}
+
+// NewMemFileSystem returns an empty in-memory backend.
+func NewMemFileSystem() *MemFileSystem {
+	return &MemFileSystem{root: &memNode{
+		name:     "/",
+		mode:     os.ModeDir | 0755,
+		modTime:  time.Now(),
+		children: map[string]*memNode{},
+	}}
+}
+
+// memKey turns a host path into the slash separated key used by MemFileSystem.
+func memKey(name string) string {
+	name = filepath.ToSlash(name)
+	if vol := filepath.VolumeName(name); vol != "" {
+		name = name[len(vol):]
+	}
+	return path.Clean("/" + name)[1:]
+}
+
+func splitKey(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return strings.Split(key, "/")
+}
+
+func memErr(op, name string, err error) error {
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// lookup resolves name. When the final element does not exist node is nil and
+// parent/base describe where it would be created.
+func (m *MemFileSystem) lookup(name string, followLast bool) (node, parent *memNode, base string, err error) {
+	parts := splitKey(memKey(name))
+	hops := 0
+restart:
+	dir := m.root
+	for i, part := range parts {
+		last := i == len(parts)-1
+		child := dir.children[part]
+		if child == nil {
+			if last {
+				return nil, dir, part, nil
+			}
+			return nil, nil, "", syscall.ENOENT
+		}
+		if child.isSymlink() && (!last || followLast) {
+			hops++
+			if hops > maxSymlinkHops {
+				return nil, nil, "", errLoop
+			}
+			target := filepath.ToSlash(child.target)
+			if !strings.HasPrefix(target, "/") && !filepath.IsAbs(child.target) {
+				target = path.Join(strings.Join(parts[:i], "/"), target)
+			}
+			rest := strings.Join(parts[i+1:], "/")
+			parts = splitKey(memKey(path.Join(target, rest)))
+			goto restart
+		}
+		if last {
+			return child, dir, part, nil
+		}
+		if !child.isDir() {
+			return nil, nil, "", syscall.ENOTDIR
+		}
+		dir = child
+	}
+	return m.root, nil, "", nil
+}
+
+// find resolves name and fails if it does not exist.
+func (m *MemFileSystem) find(op, name string, followLast bool) (*memNode, error) {
+	node, _, _, err := m.lookup(name, followLast)
+	if err != nil {
+		return nil, memErr(op, name, err)
+	}
+	if node == nil {
+		return nil, memErr(op, name, syscall.ENOENT)
+	}
+	return node, nil
+}
+
+// OpenFile opens the named file. Directories can only be opened read-only.
+func (m *MemFileSystem) OpenFile(name string, flag int, perm os.FileMode) (FileHandle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, parent, base, err := m.lookup(name, true)
+	if err != nil {
+		return nil, memErr("open", name, err)
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	now := time.Now()
+	switch {
+	case node == nil:
+		if flag&os.O_CREATE == 0 {
+			return nil, memErr("open", name, syscall.ENOENT)
+		}
+		if base == "" {
+			return nil, memErr("open", name, syscall.EISDIR)
+		}
+		node = &memNode{name: base, mode: perm.Perm(), modTime: now}
+		parent.children[base] = node
+		parent.modTime = now
+	case flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, memErr("open", name, syscall.EEXIST)
+	case node.isDir():
+		if writable {
+			return nil, memErr("open", name, syscall.EISDIR)
+		}
+	case flag&os.O_TRUNC != 0 && writable:
+		node.data = nil
+		node.modTime = now
+	}
+	return &memFile{fs: m, node: node, name: name, flag: flag}, nil
+}
+
+// Stat returns information about the named file, following symbolic links.
+func (m *MemFileSystem) Stat(name string) (os.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, err := m.find("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(), nil
+}
+
+// Lstat returns information about the named file without following a final symbolic link.
+func (m *MemFileSystem) Lstat(name string) (os.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, err := m.find("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(), nil
+}
+
+// ReadDir returns the entries of the named directory sorted by name.
+func (m *MemFileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, err := m.find("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !node.isDir() {
+		return nil, memErr("readdir", name, syscall.ENOTDIR)
+	}
+	entries := make([]os.DirEntry, 0, len(node.children))
+	for _, child := range node.children {
+		entries = append(entries, fs.FileInfoToDirEntry(child.info()))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// Mkdir creates a single directory.
+func (m *MemFileSystem) Mkdir(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdir(name, perm)
+}
+
+func (m *MemFileSystem) mkdir(name string, perm os.FileMode) error {
+	node, parent, base, err := m.lookup(name, false)
+	if err != nil {
+		return memErr("mkdir", name, err)
+	}
+	if node != nil {
+		return memErr("mkdir", name, syscall.EEXIST)
+	}
+	now := time.Now()
+	parent.children[base] = &memNode{
+		name:     base,
+		mode:     os.ModeDir | perm.Perm(),
+		modTime:  now,
+		children: map[string]*memNode{},
+	}
+	parent.modTime = now
+	return nil
+}
+
+// MkdirAll creates the named directory together with any missing parents.
+func (m *MemFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parts := splitKey(memKey(name))
+	for i := range parts {
+		sub := strings.Join(parts[:i+1], "/")
+		node, _, _, err := m.lookup(sub, true)
+		if err != nil {
+			return memErr("mkdir", name, err)
+		}
+		if node == nil {
+			if err := m.mkdir(sub, perm); err != nil {
+				return err
+			}
+		} else if !node.isDir() {
+			return memErr("mkdir", name, syscall.ENOTDIR)
+		}
+	}
+	return nil
+}
+
+// Remove removes a file, symbolic link or empty directory.
+func (m *MemFileSystem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, parent, base, err := m.lookup(name, false)
+	if err != nil {
+		return memErr("remove", name, err)
+	}
+	if node == nil {
+		return memErr("remove", name, syscall.ENOENT)
+	}
+	if parent == nil {
+		return memErr("remove", name, syscall.EBUSY)
+	}
+	if node.isDir() && len(node.children) > 0 {
+		return memErr("remove", name, errNotEmpty)
+	}
+	delete(parent.children, base)
+	parent.modTime = time.Now()
+	return nil
+}
+
+// RemoveAll removes the named entry and everything below it in one step.
+func (m *MemFileSystem) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, parent, base, err := m.lookup(name, false)
+	if err != nil {
+		if err == syscall.ENOENT || err == syscall.ENOTDIR {
+			return nil
+		}
+		return memErr("removeall", name, err)
+	}
+	if node == nil {
+		return nil
+	}
+	if parent == nil {
+		return memErr("removeall", name, syscall.EBUSY)
+	}
+	delete(parent.children, base)
+	parent.modTime = time.Now()
+	return nil
+}
+
+// Rename moves oldname to newname with POSIX semantics: a file replaces a
+// file and a directory may only replace an empty directory.
+func (m *MemFileSystem) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	node, oldParent, oldBase, err := m.lookup(oldname, false)
+	if err != nil {
+		return linkErr(err)
+	}
+	if node == nil {
+		return linkErr(syscall.ENOENT)
+	}
+	if oldParent == nil {
+		return linkErr(syscall.EBUSY)
+	}
+	existing, newParent, newBase, err := m.lookup(newname, false)
+	if err != nil {
+		return linkErr(err)
+	}
+	if existing == node {
+		return nil
+	}
+	if newParent == nil {
+		return linkErr(syscall.EBUSY)
+	}
+	if node.isDir() {
+		for p := newParent; p != nil; p = m.parentOf(p) {
+			if p == node {
+				return linkErr(syscall.EINVAL)
+			}
+		}
+	}
+	if existing != nil {
+		switch {
+		case existing.isDir() && !node.isDir():
+			return linkErr(syscall.EISDIR)
+		case !existing.isDir() && node.isDir():
+			return linkErr(syscall.ENOTDIR)
+		case existing.isDir() && len(existing.children) > 0:
+			return linkErr(errNotEmpty)
+		}
+	}
+	now := time.Now()
+	delete(oldParent.children, oldBase)
+	node.name = newBase
+	newParent.children[newBase] = node
+	oldParent.modTime = now
+	newParent.modTime = now
+	return nil
+}
+
+// parentOf finds the directory that contains n, or nil for the root.
+func (m *MemFileSystem) parentOf(n *memNode) *memNode {
+	var search func(dir *memNode) *memNode
+	search = func(dir *memNode) *memNode {
+		for _, child := range dir.children {
+			if child == n {
+				return dir
+			}
+			if child.isDir() {
+				if found := search(child); found != nil {
+					return found
+				}
+			}
+		}
+		return nil
+	}
+	return search(m.root)
+}
+
+// Chmod changes the permission bits of the named file, following symbolic links.
+func (m *MemFileSystem) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.find("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	node.mode = node.mode&os.ModeType | mode.Perm()
+	return nil
+}
+
+// Chtimes changes the modification time of the named file, following
+// symbolic links. Access times are not tracked.
+func (m *MemFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, err := m.find("chtimes", name, true)
+	if err != nil {
+		return err
+	}
+	node.modTime = mtime
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname.
+func (m *MemFileSystem) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, parent, base, err := m.lookup(newname, false)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	if node != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EEXIST}
+	}
+	now := time.Now()
+	parent.children[base] = &memNode{name: base, mode: os.ModeSymlink | 0777, modTime: now, target: oldname}
+	parent.modTime = now
+	return nil
+}
+
+// Readlink returns the destination of the named symbolic link.
+func (m *MemFileSystem) Readlink(name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, err := m.find("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if !node.isSymlink() {
+		return "", memErr("readlink", name, syscall.EINVAL)
+	}
+	return node.target, nil
+}
+
+// memFile is an open handle on a MemFileSystem entry.
+type memFile struct {
+	fs     *MemFileSystem
+	node   *memNode
+	name   string
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return 0, memErr("read", f.name, os.ErrClosed)
+	}
+	if f.node.isDir() {
+		return 0, memErr("read", f.name, syscall.EISDIR)
+	}
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, memErr("read", f.name, errBadFile)
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return 0, memErr("write", f.name, os.ErrClosed)
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, memErr("write", f.name, errBadFile)
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	end := f.offset + int64(len(p))
+	if end > int64(len(f.node.data)) {
+		grown := make([]byte, end)
+		copy(grown, f.node.data)
+		f.node.data = grown
+	}
+	copy(f.node.data[f.offset:], p)
+	f.offset = end
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return 0, memErr("seek", f.name, os.ErrClosed)
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, memErr("seek", f.name, syscall.EINVAL)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return memErr("close", f.name, os.ErrClosed)
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.RLock()
+	defer f.fs.mu.RUnlock()
+	return f.node.info(), nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+// memFileInfo describes a MemFileSystem entry.
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	// node identifies the entry for sameFile
+	node *memNode
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() os.FileMode  { return i.mode }
+func (i memFileInfo) ModTime() time.Time { return i.modTime }
+func (i memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memFileInfo) Sys() any           { return nil }
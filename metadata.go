@@ -0,0 +1,154 @@
+package easyFS
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// preservedModeBits are the mode bits PreserveMode copies.
+const preservedModeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// preserves tells whether opts ask for any metadata to be copied.
+func (opts CopyOptions) preserves() bool {
+	return opts.PreserveMode || opts.PreserveTimes || opts.PreserveOwner || opts.PreserveXattrs
+}
+
+// preserveMetadata copies the metadata selected in opts from src, described
+// by info, to dest. The owner comes first since changing it clears the
+// setuid bits, and the times last since the other changes would bump them.
+func (opts CopyOptions) preserveMetadata(src, dest PathHandler, info os.FileInfo) error {
+	isLink := info.Mode()&os.ModeSymlink != 0
+	if opts.PreserveOwner {
+		if uid, gid, ok := fileOwner(info); ok {
+			if err := lchown(dest, uid, gid); err != nil && !errors.Is(err, os.ErrPermission) && !errors.Is(err, errors.ErrUnsupported) {
+				return err
+			}
+		}
+	}
+	if isLink {
+		// links have no mode of their own and their times and attributes
+		// cannot be set portably
+		return nil
+	}
+	if opts.PreserveXattrs {
+		if err := copyXattrs(src, dest); err != nil {
+			return err
+		}
+	}
+	if opts.PreserveMode {
+		if err := dest.SetPerm(info.Mode() & preservedModeBits); err != nil {
+			return err
+		}
+	}
+	if opts.PreserveTimes {
+		if err := chtimes(dest, fileAtime(info), info.ModTime()); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+	}
+	return nil
+}
+
+// metadataError reports that the metadata of src could not be preserved on
+// its copy dest. The path of the staged copy err may name is dropped, as the
+// copy has been renamed to dest since.
+func metadataError(src, dest PathHandler, err error) error {
+	var fsErr *Error
+	var pathErr *os.PathError
+	switch {
+	case errors.As(err, &fsErr):
+		err = fmt.Errorf("%s: %w", fsErr.Op, fsErr.Err)
+	case errors.As(err, &pathErr):
+		err = fmt.Errorf("%s: %w", pathErr.Op, pathErr.Err)
+	}
+	return &Error{Op: "copy", Path: src.String(), Path2: dest.String(), Err: err}
+}
+
+// lchown changes the owner of p, failing with errors.ErrUnsupported when the
+// backend cannot.
+func lchown(p PathHandler, uid, gid int) error {
+	c, ok := p.FileSystem().(LchownFS)
+	if !ok {
+		return &Error{Op: "lchown", Path: p.String(), Err: errors.ErrUnsupported}
+	}
+	return c.Lchown(p.String(), uid, gid)
+}
+
+// copyXattrs copies the extended attributes of src to dest. Attributes are
+// skipped when either backend does not support them, or when the caller may
+// not set them, as with security.* attributes for unprivileged users.
+func copyXattrs(src, dest PathHandler) error {
+	from, ok := src.FileSystem().(XattrFS)
+	to, ok2 := dest.FileSystem().(XattrFS)
+	if !ok || !ok2 {
+		return nil
+	}
+	names, err := from.ListXattr(src.String())
+	if err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		return err
+	}
+	for _, name := range names {
+		data, err := from.GetXattr(src.String(), name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) || isNoXattr(err) {
+				// removed in the meantime
+				continue
+			}
+			return err
+		}
+		err = to.SetXattr(dest.String(), name, data)
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) && !errors.Is(err, os.ErrPermission) {
+			return err
+		}
+	}
+	return nil
+}
+
+// copySymlink recreates the symbolic link f in destDir. When opts say to
+// overwrite, whatever other than a directory is there already is replaced.
+// Like File.CopyWith, it keeps the link when its metadata could not be
+// preserved and returns it together with the error.
+func (f File) copySymlink(destDir Dir, opts CopyOptions, tracker *copyTracker) (File, error) {
+	info, err := f.Lstat()
+	if err != nil {
+		return File{}, err
+	}
+	target, err := f.Readlink()
+	if err != nil {
+		return File{}, err
+	}
+	if err := destDir.CreateIfNotExist(); err != nil {
+		return File{}, err
+	}
+	dest, ok, err := resolveConflict(opts.Conflict, opts.OnConflict, "copy", f.PathHandler, destDir.Join(f.Name()))
+	if err != nil {
+		return File{}, err
+	}
+	if !ok {
+		tracker.skipFile(0)
+		return dest.File(), nil
+	}
+	if existing, err := dest.Lstat(); err == nil && existing.IsDir() {
+		return File{}, &Error{Op: "copy", Path: f.String(), Path2: dest.String(), Err: ErrIsDirectory}
+	}
+	// the link is made next to dest and renamed over it, so a failure
+	// leaves whatever is there alone
+	temp := tempName(dest)
+	if err := target.Symlink(temp); err != nil {
+		return File{}, err
+	}
+	merr := opts.preserveMetadata(f.PathHandler, temp, info)
+	if err := rename(temp, dest); err != nil {
+		remove(temp)
+		return File{}, err
+	}
+	tracker.setCurrent(f.PathHandler)
+	tracker.fileDone()
+	if merr != nil {
+		return dest.File(), metadataError(f.PathHandler, dest, merr)
+	}
+	return dest.File(), nil
+}
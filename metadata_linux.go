@@ -0,0 +1,76 @@
+//go:build linux
+
+package easyFS
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fileAtime returns the access time recorded in info, or its modification
+// time if info does not come from the OS.
+func fileAtime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Atim.Unix())
+	}
+	return info.ModTime()
+}
+
+func listXattr(name string) ([]string, error) {
+	var buf []byte
+	for {
+		size, err := syscall.Listxattr(name, nil)
+		if err != nil {
+			return nil, &os.PathError{Op: "listxattr", Path: name, Err: err}
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		buf = make([]byte, size)
+		size, err = syscall.Listxattr(name, buf)
+		if err == syscall.ERANGE {
+			// the list grew in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "listxattr", Path: name, Err: err}
+		}
+		return strings.FieldsFunc(string(buf[:size]), func(r rune) bool { return r == 0 }), nil
+	}
+}
+
+func getXattr(name, attr string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(name, attr, nil)
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: name, Err: err}
+		}
+		buf := make([]byte, size)
+		if size == 0 {
+			return buf, nil
+		}
+		size, err = syscall.Getxattr(name, attr, buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: name, Err: err}
+		}
+		return buf[:size], nil
+	}
+}
+
+// isNoXattr tells whether err reports an attribute that does not exist.
+func isNoXattr(err error) bool {
+	return errors.Is(err, syscall.ENODATA)
+}
+
+func setXattr(name, attr string, data []byte) error {
+	if err := syscall.Setxattr(name, attr, data, 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	return nil
+}
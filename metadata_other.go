@@ -0,0 +1,32 @@
+//go:build !linux
+
+package easyFS
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// fileAtime returns the modification time of info, as the access time is
+// not portable.
+func fileAtime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+func listXattr(name string) ([]string, error) {
+	return nil, &os.PathError{Op: "listxattr", Path: name, Err: errors.ErrUnsupported}
+}
+
+func getXattr(name, attr string) ([]byte, error) {
+	return nil, &os.PathError{Op: "getxattr", Path: name, Err: errors.ErrUnsupported}
+}
+
+// isNoXattr tells whether err reports an attribute that does not exist.
+func isNoXattr(err error) bool {
+	return false
+}
+
+func setXattr(name, attr string, data []byte) error {
+	return &os.PathError{Op: "setxattr", Path: name, Err: errors.ErrUnsupported}
+}
@@ -0,0 +1,156 @@
+package easyFS
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"strconv"
+)
+
+// errCopyMismatch reports that a cross-device move found its copy to differ
+// from the source, which is then kept.
+var errCopyMismatch = errors.New("easyFS: copy does not match the source")
+
+// movePath renames oldpath to newpath. When that is impossible because they
+// are on different devices or backends, it copies oldpath, with its metadata
+// and symbolic links, to a hidden staging directory next to newpath, checks
+// the copy against the source, flushes it to stable storage, renames it into
+// place and only then removes the source. The staged copy is discarded if
+// anything fails before.
+func movePath(oldpath, newpath PathHandler) error {
+	err := rename(oldpath, newpath)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+	info, err := oldpath.Lstat()
+	if err != nil {
+		return err
+	}
+	staging := newpath.Parent().Join("." + newpath.Name() + ".moving-" + strconv.FormatUint(rand.Uint64(), 36)).Dir()
+	if err := staging.FileSystem().Mkdir(staging.String(), 0700); err != nil {
+		return newError("mkdir", staging.PathHandler, err)
+	}
+	defer removeAll(staging.PathHandler)
+	opts := CopyOptions{PreserveMode: true, PreserveTimes: true, PreserveOwner: true, PreserveXattrs: true, CopySymlinks: true}
+	staged := staging.Join(oldpath.Name())
+	if info.IsDir() {
+		err = oldpath.Dir().CopyWith(context.Background(), staged, opts)
+	} else {
+		_, err = oldpath.File().CopyWith(context.Background(), staging, opts)
+	}
+	if err != nil {
+		return err
+	}
+	if err := verifyCopy(oldpath, staged); err != nil {
+		return err
+	}
+	// the copy is written without syncing, so it has to reach the disk
+	// before the source may go
+	if err := syncTree(staged); err != nil {
+		return err
+	}
+	if err := syncDir(staging); err != nil {
+		return err
+	}
+	if err := rename(staged, newpath); err != nil {
+		return err
+	}
+	if err := syncDir(newpath.Parent()); err != nil {
+		return err
+	}
+	return removeAll(oldpath)
+}
+
+// syncTree flushes every regular file and directory below p, p included, to
+// stable storage. Symbolic links are covered by syncing their directory.
+func syncTree(p PathHandler) error {
+	info, err := p.Lstat()
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.IsDir():
+		entries, err := readDir(p)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := syncTree(p.Join(entry.Name())); err != nil {
+				return err
+			}
+		}
+		return syncDir(p.Dir())
+	case info.Mode().IsRegular():
+		file, err := p.open(os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		err = syncHandle(file)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	return nil
+}
+
+// verifyCopy checks that dest has the same entries as src, the files with
+// the same content and the links with the same targets.
+func verifyCopy(src, dest PathHandler) error {
+	mismatch := &Error{Op: "move", Path: src.String(), Path2: dest.String(), Err: errCopyMismatch}
+	srcInfo, err := src.Lstat()
+	if err != nil {
+		return err
+	}
+	destInfo, err := dest.Lstat()
+	if err != nil {
+		return err
+	}
+	if srcInfo.Mode().Type() != destInfo.Mode().Type() {
+		return mismatch
+	}
+	switch {
+	case srcInfo.Mode()&os.ModeSymlink != 0:
+		srcTarget, err := src.Readlink()
+		if err != nil {
+			return err
+		}
+		if destTarget, err := dest.Readlink(); err != nil || destTarget != srcTarget {
+			return mismatch
+		}
+	case srcInfo.IsDir():
+		entries, err := readDir(src)
+		if err != nil {
+			return err
+		}
+		copied, err := readDir(dest)
+		if err != nil {
+			return err
+		}
+		if len(entries) != len(copied) {
+			return mismatch
+		}
+		for _, entry := range entries {
+			if err := verifyCopy(src.Join(entry.Name()), dest.Join(entry.Name())); err != nil {
+				return err
+			}
+		}
+	case srcInfo.Mode().IsRegular():
+		if srcInfo.Size() != destInfo.Size() {
+			return mismatch
+		}
+		srcSum, err := src.File().Hash(SHA256)
+		if err != nil {
+			return err
+		}
+		destSum, err := dest.File().Hash(SHA256)
+		if err != nil {
+			return err
+		}
+		if srcSum != destSum {
+			return mismatch
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // PathHandler represents a file or directory path.
@@ -42,7 +43,7 @@ func (p PathHandler) IsValidPath() bool {
 //	exists := path.Exists()
 //	fmt.Println(exists) // Output: true or false
 func (p PathHandler) Exists() bool {
-	_, err := os.Stat(p.String())
+	_, err := p.Stat()
 	return err == nil
 }
 
@@ -54,7 +55,7 @@ func (p PathHandler) Exists() bool {
 //	isDir := path.IsDir()
 //	fmt.Println(isDir) // Output: true or false
 func (p PathHandler) IsDir() bool {
-	info, err := os.Stat(p.String())
+	info, err := p.Stat()
 	if err != nil {
 		return false
 	}
@@ -69,7 +70,7 @@ func (p PathHandler) IsDir() bool {
 //	isFile := path.IsFile()
 //	fmt.Println(isFile) // Output: true or false
 func (p PathHandler) IsFile() bool {
-	info, err := os.Stat(p.String())
+	info, err := p.Stat()
 	if err != nil {
 		return false
 	}
@@ -84,7 +85,7 @@ func (p PathHandler) IsFile() bool {
 //	isSymlink := path.IsSymlink()
 //	fmt.Println(isSymlink) // Output: true or false
 func (p PathHandler) IsSymlink() bool {
-	info, err := os.Lstat(p.String())
+	info, err := p.Lstat()
 	if err != nil {
 		return false
 	}
@@ -100,7 +101,20 @@ func (p PathHandler) IsSymlink() bool {
 //	    fmt.Println(info.Name()) // Output: file
 //	}
 func (p PathHandler) Stat() (PathInfo, error) {
-	return os.Stat(p.String())
+	info, err := p.FileSystem().Stat(p.String())
+	if err != nil {
+		return nil, newError("stat", p, err)
+	}
+	return info, nil
+}
+
+// Lstat returns information about the path without following symbolic links.
+func (p PathHandler) Lstat() (PathInfo, error) {
+	info, err := p.FileSystem().Lstat(p.String())
+	if err != nil {
+		return nil, newError("lstat", p, err)
+	}
+	return info, nil
 }
 
 // IsAbs reports whether the path is absolute.
@@ -183,9 +197,9 @@ func (p PathHandler) IsDescendantOf(other PathHandler) bool {
 // Returns any error encountered.
 func (p PathHandler) DeletePath(force bool) error {
 	if force {
-		return os.RemoveAll(p.String())
+		return removeAll(p)
 	} else {
-		return os.Remove(p.String())
+		return remove(p)
 	}
 }
 
@@ -202,35 +216,68 @@ func (p PathHandler) Dir() Dir {
 
 // Rename renames the directory represented by the path.
 // newName is the new name for the directory.
-// Returns any error encountered.
+// Returns any error encountered. Use RenameWith to choose what happens when
+// newName exists already.
 func (p *PathHandler) Rename(newName string) error {
 	// Rename the directory
-	err := os.Rename(p.String(), string(Join(p.Parent().String(), newName)))
-	if err == nil {
-		newHandler := Join(p.Parent().String(), newName)
-		*p = newHandler
+	newHandler := Join(p.Parent().String(), newName)
+	if err := movePath(*p, newHandler); err != nil {
+		return newLinkError("rename", *p, newHandler, err)
 	}
-	return err
+	*p = newHandler
+	return nil
 }
 
 // Move moves the directory represented by the path to a new location.
 // newPath is the new path for the directory.
-// Returns any error encountered.
+// Returns any error encountered. Use MoveWith to choose what happens when
+// the destination exists already.
+//
+// Across devices or backends, where a plain rename fails, the path is copied
+// with its metadata, the copy is verified and only then is the source
+// removed.
 func (p *PathHandler) Move(newPath PathHandler) error {
 	// Get the name
 	name := p.Name()
 	// Move the directory
 	dest := Join(newPath.String(), name)
-	err := os.Rename(p.String(), dest.String())
-	if err == nil {
-		*p = dest
+	if err := movePath(*p, dest); err != nil {
+		return newLinkError("move", *p, dest, err)
 	}
-	return err
+	*p = dest
+	return nil
 }
 
 // SetPerm sets the permission bits for the path.
 // perm is the permission bits to set.
 // Returns any error encountered.
 func (p PathHandler) SetPerm(perm os.FileMode) error {
-	return os.Chmod(p.String(), perm)
+	if err := p.FileSystem().Chmod(p.String(), perm); err != nil {
+		return newError("chmod", p, err)
+	}
+	return nil
+}
+
+// SetModTime sets the access and modification times of the path to t.
+// Backends without ChtimesFS return an error wrapping errors.ErrUnsupported.
+func (p PathHandler) SetModTime(t time.Time) error {
+	return chtimes(p, t, t)
+}
+
+// Symlink creates a symbolic link at link that points to the path.
+// Returns any error encountered.
+func (p PathHandler) Symlink(link PathHandler) error {
+	if err := link.FileSystem().Symlink(p.String(), link.String()); err != nil {
+		return newLinkError("symlink", p, link, err)
+	}
+	return nil
+}
+
+// Readlink returns the destination of the symbolic link at the path.
+func (p PathHandler) Readlink() (PathHandler, error) {
+	target, err := p.FileSystem().Readlink(p.String())
+	if err != nil {
+		return "", newError("readlink", p, err)
+	}
+	return PathHandler(target), nil
 }
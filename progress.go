@@ -0,0 +1,176 @@
+package easyFS
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// defaultProgressInterval is how often progress is reported when
+// CopyOptions.ProgressInterval is not set.
+const defaultProgressInterval = 500 * time.Millisecond
+
+// CopyProgress is a snapshot of a running copy, passed to
+// CopyOptions.Progress.
+type CopyProgress struct {
+	// BytesCopied is the number of bytes written so far.
+	BytesCopied int64
+	// FilesCopied is the number of files copied completely. Files skipped
+	// because of a ConflictPolicy count as copied, and so do their bytes.
+	FilesCopied int
+	// BytesTotal and FilesTotal are what the whole copy amounts to. They are
+	// only known for a single file, or for a directory with PreScan set, and
+	// are 0 otherwise.
+	BytesTotal int64
+	FilesTotal int
+	// CurrentPath is the source file being copied.
+	CurrentPath PathHandler
+	// Elapsed is the time since the copy started.
+	Elapsed time.Duration
+	// BytesPerSecond is the average throughput so far.
+	BytesPerSecond float64
+	// ETA estimates the time left. It is 0 when the totals are unknown.
+	ETA time.Duration
+	// Done is set on the last report, sent once the copy has finished or failed.
+	Done bool
+}
+
+// copyTracker accumulates the progress of one Copy call, shared by the
+// recursive calls it makes.
+type copyTracker struct {
+	report   func(CopyProgress)
+	interval time.Duration
+
+	mu       sync.Mutex
+	start    time.Time
+	last     time.Time
+	progress CopyProgress
+}
+
+func newCopyTracker(opts CopyOptions) *copyTracker {
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	now := time.Now()
+	return &copyTracker{report: opts.Progress, interval: interval, start: now, last: now}
+}
+
+// tracker returns the tracker of the copy opts belong to, starting a new one
+// when progress is wanted and none is running yet. started tells whether the
+// caller owns the new tracker and must finish it.
+func (opts *CopyOptions) tracker() (t *copyTracker, started bool) {
+	if opts.Progress == nil || opts.progress != nil {
+		return opts.progress, false
+	}
+	opts.progress = newCopyTracker(*opts)
+	return opts.progress, true
+}
+
+// snapshot fills in the derived fields. The caller holds t.mu.
+func (t *copyTracker) snapshot(now time.Time) CopyProgress {
+	p := t.progress
+	p.Elapsed = now.Sub(t.start)
+	if seconds := p.Elapsed.Seconds(); seconds > 0 {
+		p.BytesPerSecond = float64(p.BytesCopied) / seconds
+	}
+	if p.BytesTotal > p.BytesCopied && p.BytesPerSecond > 0 {
+		p.ETA = time.Duration(float64(p.BytesTotal-p.BytesCopied) / p.BytesPerSecond * float64(time.Second))
+	}
+	return p
+}
+
+// update applies fn to the progress and reports it if the interval has
+// passed since the last report, or unconditionally if force is set.
+func (t *copyTracker) update(force bool, fn func(p *CopyProgress)) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(&t.progress)
+	now := time.Now()
+	if !force && now.Sub(t.last) < t.interval {
+		return
+	}
+	t.last = now
+	// reporting under the lock keeps the calls ordered and never concurrent
+	t.report(t.snapshot(now))
+}
+
+func (t *copyTracker) setTotals(files int, bytes int64) {
+	t.update(false, func(p *CopyProgress) {
+		p.FilesTotal, p.BytesTotal = files, bytes
+	})
+}
+
+func (t *copyTracker) setCurrent(path PathHandler) {
+	t.update(false, func(p *CopyProgress) { p.CurrentPath = path })
+}
+
+func (t *copyTracker) addBytes(n int64) {
+	t.update(false, func(p *CopyProgress) { p.BytesCopied += n })
+}
+
+func (t *copyTracker) fileDone() {
+	t.update(false, func(p *CopyProgress) { p.FilesCopied++ })
+}
+
+// skipFile counts a file left out because of a conflict as done, so the
+// progress still reaches the totals.
+func (t *copyTracker) skipFile(size int64) {
+	t.update(false, func(p *CopyProgress) {
+		p.BytesCopied += size
+		p.FilesCopied++
+	})
+}
+
+// finish sends the final report.
+func (t *copyTracker) finish() {
+	t.update(true, func(p *CopyProgress) { p.Done = true })
+}
+
+// progressReader counts the bytes read through it into a tracker.
+type progressReader struct {
+	r io.Reader
+	t *copyTracker
+}
+
+func (r progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.t.addBytes(int64(n))
+	}
+	return n, err
+}
+
+// scanCopy counts the files and bytes Dir.CopyWith would copy from d.
+func scanCopy(ctx context.Context, d Dir, opts CopyOptions) (files int, bytes int64, err error) {
+	if err := ctxErr(ctx, "copy", d.PathHandler); err != nil {
+		return 0, 0, err
+	}
+	all, err := d.All()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, entry := range all {
+		isLink := opts.CopySymlinks && entry.IsSymlink()
+		isDir := entry.IsDir() && !isLink
+		if opts.Ignore.Match(entry, isDir) {
+			continue
+		}
+		if isDir {
+			n, size, err := scanCopy(ctx, entry.Dir(), opts)
+			if err != nil {
+				return 0, 0, err
+			}
+			files, bytes = files+n, bytes+size
+		} else if isLink {
+			files++
+		} else if info, err := entry.Stat(); err == nil && info.Mode().IsRegular() {
+			files, bytes = files+1, bytes+info.Size()
+		}
+	}
+	return files, bytes, nil
+}
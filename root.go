@@ -0,0 +1,175 @@
+package easyFS
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Root is a directory that confines the names given to it, in the spirit of
+// os.Root. Every path it derives is resolved below the directory, following
+// symbolic links as the file system would, and names that would lead outside
+// of it through "..", an absolute path or a symbolic link are rejected with
+// an error wrapping ErrPathEscape. Links are resolved lexically, so absolute
+// link targets are rejected even when they point inside the root.
+//
+// Use a Root for names that come from users or other untrusted sources. The
+// checks are made when a path is derived, so a Root does not guard against
+// another process swapping a directory for a symbolic link in between.
+type Root struct {
+	dir Dir
+}
+
+// OpenRoot returns a Root confining names to dir, which must exist.
+//
+// Example:
+//
+//	uploads, err := OpenRoot(NewDir("/srv/uploads"))
+//	if err != nil {
+//	    return err
+//	}
+//	file, err := uploads.CreateFileWithData(userSuppliedName, data, false)
+//	if errors.Is(err, ErrPathEscape) {
+//	    // the name tried to leave /srv/uploads
+//	}
+func OpenRoot(dir Dir) (*Root, error) {
+	info, err := dir.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &Error{Op: "openroot", Path: dir.String(), Err: ErrNotDirectory}
+	}
+	abs, err := dir.Abs()
+	if err != nil {
+		return nil, err
+	}
+	return &Root{dir: NewDir(PathHandler(abs))}, nil
+}
+
+// Dir returns the root directory.
+func (r *Root) Dir() Dir {
+	return r.dir
+}
+
+// resolve returns the path of the slash or OS separated name below the
+// root, following a final symbolic link only if followLast is set.
+func (r *Root) resolve(op, name string, followLast bool) (PathHandler, error) {
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" || strings.HasPrefix(filepath.ToSlash(name), "/") {
+		return "", &Error{Op: op, Path: name, Err: ErrPathEscape}
+	}
+	rel, err := resolveBelow(r.dir.PathHandler, name, followLast)
+	if errors.Is(err, ErrPathEscape) {
+		return "", &Error{Op: op, Path: name, Err: ErrPathEscape}
+	}
+	if err != nil {
+		return "", err
+	}
+	return r.dir.Join(filepath.FromSlash(rel)), nil
+}
+
+// resolveEntry is like resolve for the methods that change an entry below
+// the root. Names resolving to the root itself, such as "." and "", are
+// rejected, as they would act on its parent.
+func (r *Root) resolveEntry(op, name string, followLast bool) (PathHandler, error) {
+	p, err := r.resolve(op, name, followLast)
+	if err != nil {
+		return "", err
+	}
+	if p == r.dir.PathHandler {
+		return "", &Error{Op: op, Path: name, Err: os.ErrInvalid}
+	}
+	return p, nil
+}
+
+// Join joins the elements to a path below the root, with symbolic links
+// resolved. The elements must be relative.
+//
+// Example:
+//
+//	p, err := root.Join("avatars", userID+".png")
+//	data, err := p.File().Read()
+func (r *Root) Join(elem ...string) (PathHandler, error) {
+	for _, e := range elem {
+		if filepath.IsAbs(e) || filepath.VolumeName(e) != "" || strings.HasPrefix(filepath.ToSlash(e), "/") {
+			return "", &Error{Op: "join", Path: e, Err: ErrPathEscape}
+		}
+	}
+	return r.resolve("join", strings.Join(elem, "/"), true)
+}
+
+// CreateSubdir creates the directory name below the root, together with any
+// missing parents. Like every method changing an entry, it rejects names
+// resolving to the root itself with an error wrapping os.ErrInvalid.
+func (r *Root) CreateSubdir(name string) (Dir, error) {
+	p, err := r.resolveEntry("mkdir", name, true)
+	if err != nil {
+		return Dir{}, err
+	}
+	if err := p.Dir().CreateIfNotExist(); err != nil {
+		return Dir{}, err
+	}
+	return p.Dir(), nil
+}
+
+// CreateFile creates the file name below the root like Dir.CreateFile.
+func (r *Root) CreateFile(name string, overwrite bool) (File, error) {
+	p, err := r.resolveEntry("create", name, true)
+	if err != nil {
+		return File{}, err
+	}
+	return p.Parent().CreateFile(p.Name(), overwrite)
+}
+
+// CreateFileWithData creates the file name below the root with data like
+// Dir.CreateFileWithData with WriteOptions.Atomic, so an existing file is
+// only replaced when overwrite is set and fails with ErrExist otherwise.
+func (r *Root) CreateFileWithData(name string, data []byte, overwrite bool) (File, error) {
+	p, err := r.resolveEntry("create", name, true)
+	if err != nil {
+		return File{}, err
+	}
+	return p.Parent().CreateFileWithData(p.Name(), data, overwrite, WriteOptions{Atomic: true})
+}
+
+// DeleteSubFile deletes the file name below the root. A symbolic link is
+// deleted itself, not its target.
+func (r *Root) DeleteSubFile(name string) error {
+	p, err := r.resolveEntry("delete", name, false)
+	if err != nil {
+		return err
+	}
+	return p.File().Delete()
+}
+
+// DeleteSubDir deletes the directory name below the root, with its content
+// if recursive is set. A symbolic link is deleted itself, not its target.
+func (r *Root) DeleteSubDir(name string, recursive bool) error {
+	p, err := r.resolveEntry("delete", name, false)
+	if err != nil {
+		return err
+	}
+	return p.Dir().Delete(recursive)
+}
+
+// Find finds paths below the root whose relative path matches the pattern,
+// like Dir.Find. Symbolic links leading outside the root are left out.
+func (r *Root) Find(match string, recursive bool, quantity int) ([]PathHandler, error) {
+	pattern, err := CompilePattern(match)
+	if err != nil {
+		return nil, err
+	}
+	return r.FindWith(context.Background(), pattern, findOptions(recursive, quantity, FindAny))
+}
+
+// FindWith is like Dir.FindWith, leaving out symbolic links that lead
+// outside the root and not following them with FollowSymlinks.
+func (r *Root) FindWith(ctx context.Context, pattern *Pattern, opts FindOptions) ([]PathHandler, error) {
+	opts.keep = func(p PathHandler) bool {
+		_, err := resolveBelow(r.dir.PathHandler, r.dir.slashRel(p), true)
+		return err == nil
+	}
+	return r.dir.FindWith(ctx, pattern, opts)
+}
@@ -0,0 +1,295 @@
+package easyFS
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"time"
+)
+
+// SyncOptions controls Dir.SyncTo.
+type SyncOptions struct {
+	// Checksum compares file content instead of size and modification time.
+	Checksum bool
+	// Algorithm is the checksum algorithm used with Checksum. It defaults to SHA256.
+	Algorithm HashAlgorithm
+	// ModifyWindow is how far modification times may differ for a file to
+	// count as unchanged, for destinations storing them less precisely, such
+	// as 2s for FAT. 0 requires them to be equal.
+	ModifyWindow time.Duration
+	// Delete removes destination entries that do not exist in the source.
+	Delete bool
+	// Include only syncs files matching it, relative to the source directory.
+	Include *Pattern
+	// Exclude skips matching files and directories, relative to the source directory.
+	Exclude *Pattern
+	// Ignore skips ignored source paths like Exclude.
+	Ignore *Ignore
+	// DryRun reports what would change without touching the destination.
+	DryRun bool
+}
+
+// SyncReport lists what Dir.SyncTo changed, or would change in a dry run.
+// Paths are slash separated and relative to the synced directories.
+type SyncReport struct {
+	// Added lists files and directories created in the destination.
+	Added []string
+	// Updated lists destination files that were replaced.
+	Updated []string
+	// Deleted lists extraneous destination entries that were removed.
+	Deleted []string
+	// Skipped lists files that were already up to date.
+	Skipped []string
+}
+
+// SyncTo makes dest a copy of the directory, copying only what changed. A
+// file is considered unchanged when size and modification time match, the
+// time within ModifyWindow, or with Checksum when its content does. Copied
+// files get the permissions and modification time of their source, so the
+// next sync can skip them.
+// Symbolic links are recreated as links and never followed, so dangling
+// links and links to an ancestor directory are synced like any other.
+//
+// Excluded, ignored and, for files, not included paths are neither copied
+// nor deleted from the destination.
+//
+// Example:
+//
+//	report, err := NewDir("/path/to/site").SyncTo("/mnt/backup/site", SyncOptions{
+//	    Delete:  true,
+//	    Exclude: MustCompilePattern("{*.tmp,.cache}"),
+//	})
+//	fmt.Println(len(report.Updated), "files updated")
+func (d Dir) SyncTo(dest PathHandler, opts SyncOptions) (SyncReport, error) {
+	return d.SyncToContext(context.Background(), dest, opts)
+}
+
+// SyncToContext is like SyncTo but stops as soon as ctx is cancelled. The
+// report lists what was done until then.
+func (d Dir) SyncToContext(ctx context.Context, dest PathHandler, opts SyncOptions) (SyncReport, error) {
+	var report SyncReport
+	if opts.Checksum {
+		if opts.Algorithm == "" {
+			opts.Algorithm = SHA256
+		}
+		if _, err := opts.Algorithm.New(); err != nil {
+			return report, err
+		}
+	}
+	info, err := d.Stat()
+	if err != nil {
+		return report, err
+	}
+	if !dest.IsDir() && !opts.DryRun {
+		if err := mkdirAll(dest, info.Mode().Perm()); err != nil {
+			return report, err
+		}
+	}
+	s := syncer{root: d, opts: opts, report: &report}
+	err = s.sync(ctx, d, dest.Dir())
+	return report, err
+}
+
+type syncer struct {
+	root   Dir
+	opts   SyncOptions
+	report *SyncReport
+}
+
+// skip reports whether the source path p is left out of the sync.
+func (s syncer) skip(p PathHandler, isDir bool) bool {
+	rel := s.root.slashRel(p)
+	if s.opts.Ignore.Match(p, isDir) || (s.opts.Exclude != nil && s.opts.Exclude.Match(rel)) {
+		return true
+	}
+	return !isDir && s.opts.Include != nil && !s.opts.Include.Match(rel)
+}
+
+func (s syncer) sync(ctx context.Context, src, dst Dir) error {
+	entries, err := readDir(src.PathHandler)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		p := src.Join(entry.Name())
+		if err := ctxErr(ctx, "sync", p); err != nil {
+			return err
+		}
+		info, err := p.Lstat()
+		if err != nil {
+			return err
+		}
+		isLink := info.Mode()&os.ModeSymlink != 0
+		if s.skip(p, info.IsDir()) {
+			continue
+		}
+		seen[entry.Name()] = true
+		target := dst.Join(entry.Name())
+		rel := s.root.slashRel(p)
+		existing, err := target.Lstat()
+		exists, replaced := err == nil, false
+		if err != nil && !s.missing(err) {
+			return err
+		}
+		if exists && (existing.IsDir() != info.IsDir() || (existing.Mode()&os.ModeSymlink != 0) != isLink) {
+			// an entry of another type is in the way
+			if err := s.remove(target); err != nil {
+				return err
+			}
+			exists, replaced = false, true
+		}
+		if isLink {
+			if err := s.syncLink(p, target, rel, exists, replaced); err != nil {
+				return err
+			}
+			continue
+		}
+		if info.IsDir() {
+			if !exists {
+				s.report.add(rel, replaced)
+				if !s.opts.DryRun {
+					// writable until its contents are synced
+					if err := target.FileSystem().Mkdir(target.String(), 0700); err != nil {
+						return newError("mkdir", target, err)
+					}
+				}
+			}
+			if err := s.sync(ctx, p.Dir(), target.Dir()); err != nil {
+				return err
+			}
+			if !exists && !s.opts.DryRun {
+				if err := target.SetPerm(info.Mode().Perm()); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if exists {
+			same, err := s.same(ctx, p.File(), info, target.File(), existing)
+			if err != nil {
+				return err
+			}
+			if same {
+				s.report.Skipped = append(s.report.Skipped, rel)
+				continue
+			}
+		}
+		s.report.add(rel, exists || replaced)
+		if !s.opts.DryRun {
+			if err := s.copyFile(ctx, p.File(), info, dst); err != nil {
+				return err
+			}
+		}
+	}
+	if !s.opts.Delete {
+		return nil
+	}
+	existing, err := readDir(dst.PathHandler)
+	if err != nil {
+		if s.missing(err) && s.opts.DryRun {
+			return nil
+		}
+		return err
+	}
+	sort.Slice(existing, func(i, j int) bool { return existing[i].Name() < existing[j].Name() })
+	for _, entry := range existing {
+		if seen[entry.Name()] {
+			continue
+		}
+		// paths the filters leave out of the sync are protected from deletion
+		if s.skip(src.Join(entry.Name()), entry.IsDir()) {
+			continue
+		}
+		s.report.Deleted = append(s.report.Deleted, s.root.slashRel(src.Join(entry.Name())))
+		if !s.opts.DryRun {
+			if err := removeAll(dst.Join(entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// missing tells whether err says a destination entry does not exist. In a
+// dry run, a file that a directory would replace is still there, so the
+// entries below it fail with ENOTDIR instead.
+func (s syncer) missing(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || (s.opts.DryRun && KindOf(err) == ErrNotDirectory)
+}
+
+// add records a copied path as updated when it replaced an existing entry.
+func (r *SyncReport) add(rel string, replaced bool) {
+	if replaced {
+		r.Updated = append(r.Updated, rel)
+	} else {
+		r.Added = append(r.Added, rel)
+	}
+}
+
+// remove deletes a destination entry of the wrong type before it is replaced.
+func (s syncer) remove(p PathHandler) error {
+	if s.opts.DryRun {
+		return nil
+	}
+	return removeAll(p)
+}
+
+// syncLink recreates the symbolic link src at target, unless a link to the
+// same destination is there already.
+func (s syncer) syncLink(src, target PathHandler, rel string, exists, replaced bool) error {
+	link, err := src.Readlink()
+	if err != nil {
+		return err
+	}
+	if exists {
+		if current, err := target.Readlink(); err == nil && current == link {
+			s.report.Skipped = append(s.report.Skipped, rel)
+			return nil
+		}
+	}
+	s.report.add(rel, exists || replaced)
+	if s.opts.DryRun {
+		return nil
+	}
+	if exists {
+		if err := remove(target); err != nil {
+			return err
+		}
+	}
+	return link.Symlink(target)
+}
+
+// same reports whether the destination file is up to date.
+func (s syncer) same(ctx context.Context, src File, srcInfo PathInfo, dst File, dstInfo PathInfo) (bool, error) {
+	if !dstInfo.Mode().IsRegular() || srcInfo.Size() != dstInfo.Size() {
+		return false, nil
+	}
+	if !s.opts.Checksum {
+		return srcInfo.ModTime().Sub(dstInfo.ModTime()).Abs() <= s.opts.ModifyWindow, nil
+	}
+	srcSum, err := src.HashContext(ctx, s.opts.Algorithm)
+	if err != nil {
+		return false, err
+	}
+	dstSum, err := dst.HashContext(ctx, s.opts.Algorithm)
+	return srcSum == dstSum, err
+}
+
+// copyFile copies a file into dst and gives it the source permissions and
+// modification time. Backends without ChtimesFS keep the copy time.
+func (s syncer) copyFile(ctx context.Context, src File, info PathInfo, dst Dir) error {
+	copied, err := src.CopyWith(ctx, dst, CopyOptions{})
+	if err != nil {
+		return err
+	}
+	if err := copied.SetPerm(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := copied.SetModTime(info.ModTime()); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package easyFS
+
+import (
+	"bufio"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trashInfoExt is the extension of the metadata files in info/.
+const trashInfoExt = ".trashinfo"
+
+// trashDateLayout is the DeletionDate format of the freedesktop Trash spec,
+// in local time.
+const trashDateLayout = "2006-01-02T15:04:05"
+
+// Trash is a trash directory that deleted paths are moved into so they can be
+// restored later. It uses the layout of the freedesktop.org Trash
+// specification: the entries live in files/ and an info/<name>.trashinfo file
+// next to them records the original path and the deletion time, so desktop
+// file managers on Linux list and restore them too.
+type Trash struct {
+	root Dir
+}
+
+// TrashItem is an entry in a Trash.
+type TrashItem struct {
+	// Name is the unique name of the entry inside the trash.
+	Name string
+	// OriginalPath is the absolute path the entry was deleted from.
+	OriginalPath PathHandler
+	// DeletedAt is when the entry was moved to the trash, to the second.
+	DeletedAt time.Time
+
+	trash *Trash
+}
+
+// Path returns where the entry is kept inside the trash.
+func (i TrashItem) Path() PathHandler {
+	return i.trash.root.Join("files", i.Name)
+}
+
+// NewTrash returns a Trash kept in root. The directory is created on first use.
+//
+// Example:
+//
+//	trash := NewTrash(NewDir("/srv/app/.trash"))
+//	item, err := trash.Put("/srv/app/uploads/report.pdf")
+func NewTrash(root Dir) *Trash {
+	return &Trash{root: root}
+}
+
+// DefaultTrash returns the trash of the current user: $XDG_DATA_HOME/Trash,
+// or ~/.local/share/Trash, as used by Linux desktops. On Windows, which has no
+// such directory, it is %LocalAppData%\easyFS\Trash.
+func DefaultTrash() (*Trash, error) {
+	if runtime.GOOS == "windows" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		return NewTrash(NewDir(PathHandler(filepath.Join(dir, "easyFS", "Trash")))), nil
+	}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dataHome) {
+		return NewTrash(NewDir(PathHandler(filepath.Join(dataHome, "Trash")))), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewTrash(NewDir(PathHandler(filepath.Join(home, ".local", "share", "Trash")))), nil
+}
+
+// Root returns the trash directory.
+func (t *Trash) Root() Dir {
+	return t.root
+}
+
+// Put moves the file or directory at p into the trash. The name inside the
+// trash is reserved by creating its info file first, so concurrent Puts of
+// equally named paths never overwrite each other. A path on another device
+// or backend than the trash is moved like PathHandler.Move does, by a copy
+// that is verified before p is removed.
+//
+// Example:
+//
+//	trash, _ := DefaultTrash()
+//	item, err := trash.Put("/home/ana/notes.txt")
+//	// later
+//	err = trash.Restore(item)
+func (t *Trash) Put(p PathHandler) (TrashItem, error) {
+	if _, err := p.Lstat(); err != nil {
+		return TrashItem{}, err
+	}
+	abs, err := p.Abs()
+	if err != nil {
+		return TrashItem{}, err
+	}
+	original := PathHandler(abs)
+	if rootAbs, err := t.root.Abs(); err == nil && hasPathPrefix(abs, rootAbs) {
+		return TrashItem{}, &Error{Op: "trash", Path: p.String(), Err: errors.New("cannot trash the trash or its contents")}
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := mkdirAll(t.root.Join(sub), 0700); err != nil {
+			return TrashItem{}, err
+		}
+	}
+	item := TrashItem{OriginalPath: original, DeletedAt: time.Now().Truncate(time.Second), trash: t}
+	info := "[Trash Info]\nPath=" + escapeTrashPath(original) + "\nDeletionDate=" + item.DeletedAt.Format(trashDateLayout) + "\n"
+	for n := 1; ; n++ {
+		item.Name = p.Name()
+		if n > 1 {
+			ext := filepath.Ext(item.Name)
+			item.Name = strings.TrimSuffix(item.Name, ext) + "." + strconv.Itoa(n) + ext
+		}
+		if item.Path().Exists() || item.Path().IsSymlink() {
+			continue
+		}
+		file, err := t.infoPath(item.Name).open(os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return TrashItem{}, err
+		}
+		_, err = file.Write([]byte(info))
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = movePath(p, item.Path())
+		}
+		if err != nil {
+			remove(t.infoPath(item.Name))
+			return TrashItem{}, err
+		}
+		return item, nil
+	}
+}
+
+// Trash moves the path into trash, or into DefaultTrash if trash is nil,
+// instead of deleting it for good.
+//
+// Example:
+//
+//	item, err := PathHandler("/home/ana/old-project").Trash(nil)
+func (p PathHandler) Trash(trash *Trash) (TrashItem, error) {
+	if trash == nil {
+		var err error
+		if trash, err = DefaultTrash(); err != nil {
+			return TrashItem{}, err
+		}
+	}
+	return trash.Put(p)
+}
+
+// List returns the entries in the trash, oldest first. Info files that
+// cannot be parsed or whose entry is gone are left out.
+func (t *Trash) List() ([]TrashItem, error) {
+	entries, err := readDir(t.root.Join("info"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var items []TrashItem
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), trashInfoExt) {
+			continue
+		}
+		item, err := t.readInfo(strings.TrimSuffix(entry.Name(), trashInfoExt))
+		if err != nil {
+			continue
+		}
+		if _, err := item.Path().Lstat(); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].DeletedAt.Equal(items[j].DeletedAt) {
+			return items[i].DeletedAt.Before(items[j].DeletedAt)
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
+
+// Restore moves the entry back to its original path, creating missing parent
+// directories. It fails with an error wrapping os.ErrExist if something
+// already exists there.
+func (t *Trash) Restore(item TrashItem) error {
+	return t.RestoreTo(item, item.OriginalPath)
+}
+
+// RestoreTo moves the entry out of the trash to dest instead of its original
+// path, which may be on another device or backend than the trash. The entry
+// is first moved next to dest under a hidden name and then renamed to dest
+// without replacing anything, so it fails with an error wrapping os.ErrExist
+// even if dest appears in the meantime, and the entry stays in the trash.
+// Like Delete, it rejects items whose Name leads outside the trash.
+func (t *Trash) RestoreTo(item TrashItem, dest PathHandler) error {
+	exists := &Error{Op: "restore", Path: dest.String(), Err: os.ErrExist}
+	if _, err := dest.Lstat(); err == nil {
+		return exists
+	}
+	src, err := t.entryPath("restore", item.Name)
+	if err != nil {
+		return err
+	}
+	if err := mkdirAll(dest.Parent().PathHandler, 0755); err != nil {
+		return err
+	}
+	staged := tempName(dest)
+	if err := movePath(src, staged); err != nil {
+		return err
+	}
+	if err := renameNoReplace(staged, dest); err != nil {
+		if merr := movePath(staged, src); merr != nil {
+			return errors.Join(err, merr)
+		}
+		if errors.Is(err, os.ErrExist) {
+			return exists
+		}
+		return err
+	}
+	return remove(t.infoPath(item.Name))
+}
+
+// Delete permanently removes the entry from the trash. An item whose Name is
+// not a single name inside the trash is rejected with ErrPathEscape.
+func (t *Trash) Delete(item TrashItem) error {
+	p, err := t.entryPath("delete", item.Name)
+	if err != nil {
+		return err
+	}
+	if err := removeAll(p); err != nil {
+		return err
+	}
+	err = remove(t.infoPath(item.Name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Purge permanently removes the entries deleted more than olderThan ago and
+// returns them. Purge(0) empties the trash.
+//
+// Example:
+//
+//	purged, err := trash.Purge(30 * 24 * time.Hour)
+func (t *Trash) Purge(olderThan time.Duration) ([]TrashItem, error) {
+	items, err := t.List()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-olderThan)
+	var purged []TrashItem
+	for _, item := range items {
+		if item.DeletedAt.After(cutoff) {
+			continue
+		}
+		if err := t.Delete(item); err != nil {
+			return purged, err
+		}
+		purged = append(purged, item)
+	}
+	return purged, nil
+}
+
+// entryPath returns the path of the named entry. Names of items built by the
+// caller must be a single name inside the trash; others are rejected with an
+// error wrapping ErrPathEscape.
+func (t *Trash) entryPath(op, name string) (PathHandler, error) {
+	if !filepath.IsLocal(name) || name == "." || strings.ContainsAny(name, `/`+string(os.PathSeparator)) {
+		return "", &Error{Op: op, Path: name, Err: ErrPathEscape}
+	}
+	return t.root.Join("files", name), nil
+}
+
+func (t *Trash) infoPath(name string) PathHandler {
+	return t.root.Join("info", name+trashInfoExt)
+}
+
+// readInfo parses the info file of the named entry.
+func (t *Trash) readInfo(name string) (TrashItem, error) {
+	item := TrashItem{Name: name, trash: t}
+	file, err := t.infoPath(name).open(os.O_RDONLY, 0)
+	if err != nil {
+		return item, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	section := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = line == "[Trash Info]"
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !section || !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			path, err := url.PathUnescape(value)
+			if err != nil {
+				return item, err
+			}
+			item.OriginalPath = PathHandler(filepath.FromSlash(path))
+		case "DeletionDate":
+			item.DeletedAt, err = time.ParseInLocation(trashDateLayout, value, time.Local)
+			if err != nil {
+				return item, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return item, err
+	}
+	if item.OriginalPath == "" || item.DeletedAt.IsZero() {
+		return item, &Error{Op: "read", Path: t.infoPath(name).String(), Err: errors.New("malformed trash info")}
+	}
+	return item, nil
+}
+
+// escapeTrashPath URL-escapes every segment of the path as the spec requires.
+func escapeTrashPath(p PathHandler) string {
+	segments := strings.Split(filepath.ToSlash(p.String()), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
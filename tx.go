@@ -0,0 +1,265 @@
+package easyFS
+
+import (
+	"errors"
+	"math/rand/v2"
+	"os"
+	"strconv"
+)
+
+// ErrTxDone is returned by a Tx after it was committed or rolled back.
+var ErrTxDone = errors.New("easyFS: transaction has already been committed or rolled back")
+
+// Tx groups file system changes so that either all of them take effect or
+// none do. Every operation is applied at once, but whatever it replaces or
+// deletes is first renamed to a hidden backup next to it, named
+// ".<name>.txbak-<random>". Rollback undoes the operations in reverse order
+// and moves the backups back; Commit removes the backups.
+//
+// A Tx is not safe for concurrent use, and it cannot protect against other
+// processes changing the same paths in the meantime.
+type Tx struct {
+	ops  []txOp
+	done bool
+}
+
+type txOp struct {
+	undo   func() error
+	commit func() error
+}
+
+// NewTx starts a transaction.
+//
+// Example:
+//
+//	tx := NewTx()
+//	defer tx.Rollback()
+//	release, err := tx.CreateSubdir(NewDir("/srv/app"), "release-42")
+//	if err != nil {
+//	    return err
+//	}
+//	if _, err := tx.CreateFileWithData(release, "VERSION", []byte("42"), false); err != nil {
+//	    return err
+//	}
+//	if err := tx.Delete("/srv/app/release-41"); err != nil {
+//	    return err
+//	}
+//	return tx.Commit()
+func NewTx() *Tx {
+	return &Tx{}
+}
+
+// Transaction runs fn in a new transaction, committing it when fn returns nil
+// and rolling it back otherwise.
+//
+// Example:
+//
+//	err := Transaction(func(tx *Tx) error {
+//	    _, err := tx.Rename("/srv/app/current", "previous")
+//	    if err != nil {
+//	        return err
+//	    }
+//	    _, err = tx.Rename("/srv/app/next", "current")
+//	    return err
+//	})
+func Transaction(fn func(tx *Tx) error) error {
+	tx := NewTx()
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+func (tx *Tx) record(undo, commit func() error) {
+	tx.ops = append(tx.ops, txOp{undo: undo, commit: commit})
+}
+
+func (tx *Tx) check(op string, p PathHandler) error {
+	if tx.done {
+		return &Error{Op: op, Path: p.String(), Err: ErrTxDone}
+	}
+	return nil
+}
+
+// backup moves p out of the way to a hidden sibling and records how to bring
+// it back. It does nothing if p does not exist.
+func (tx *Tx) backup(p PathHandler) error {
+	if _, err := p.Lstat(); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		backup := p.Parent().Join("." + p.Name() + ".txbak-" + strconv.FormatUint(rand.Uint64(), 36))
+		if _, err := backup.Lstat(); err == nil && attempt < 10 {
+			continue
+		}
+		if err := rename(p, backup); err != nil {
+			return err
+		}
+		tx.record(func() error {
+			// whatever took the place of p was undone already
+			return rename(backup, p)
+		}, func() error {
+			return removeAll(backup)
+		})
+		return nil
+	}
+}
+
+// CreateSubdir creates the directory name inside parent, together with any
+// missing parents. Rollback removes the directories it created.
+func (tx *Tx) CreateSubdir(parent Dir, name string) (Dir, error) {
+	dir := parent.Join(name).Dir()
+	if err := tx.check("mkdir", dir.PathHandler); err != nil {
+		return Dir{}, err
+	}
+	// remember which levels are new so rollback leaves existing ones alone
+	var created []PathHandler
+	for p := dir.PathHandler; ; p = p.Parent().PathHandler {
+		if _, err := p.Lstat(); err == nil || p.Parent().PathHandler == p {
+			break
+		}
+		created = append(created, p)
+	}
+	err := mkdirAll(dir.PathHandler, 0755)
+	for i := len(created) - 1; i >= 0; i-- {
+		p := created[i]
+		if !p.IsDir() {
+			continue
+		}
+		tx.record(func() error {
+			return remove(p)
+		}, nil)
+	}
+	if err != nil {
+		return Dir{}, err
+	}
+	return dir, nil
+}
+
+// CreateFileWithData creates the file name inside parent with data. An
+// existing file is only replaced when overwrite is true, keeping its
+// permissions; otherwise the error wraps os.ErrExist. The new content is
+// written to a temporary file first, so a failed write leaves the old file in
+// place. When the file is a symbolic link, the file it points to is replaced
+// and the link is kept. Rollback restores the previous content or removes the
+// new file.
+func (tx *Tx) CreateFileWithData(parent Dir, name string, data []byte, overwrite bool) (File, error) {
+	file := parent.Join(name).File()
+	if err := tx.check("create", file.PathHandler); err != nil {
+		return File{}, err
+	}
+	if _, err := file.Lstat(); err == nil && !overwrite {
+		return File{}, &Error{Op: "create", Path: file.String(), Err: os.ErrExist}
+	}
+	staged, err := file.CreateAtomic()
+	if err != nil {
+		return File{}, err
+	}
+	if _, err := staged.Write(data); err != nil {
+		staged.Abort()
+		return File{}, err
+	}
+	// a symbolic link is kept and the file it points to is replaced
+	target := staged.target
+	if err := tx.backup(target); err != nil {
+		staged.Abort()
+		return File{}, err
+	}
+	if err := staged.Commit(); err != nil {
+		return File{}, err
+	}
+	tx.record(func() error {
+		return remove(target)
+	}, nil)
+	return file, nil
+}
+
+// Rename renames p to newName in the same directory and returns the new
+// path. An entry already called newName is replaced and restored by Rollback.
+func (tx *Tx) Rename(p PathHandler, newName string) (PathHandler, error) {
+	return tx.move("rename", p, p.Parent().Join(newName))
+}
+
+// Move moves p into destDir, keeping its name, and returns the new path. An
+// entry of the same name in destDir is replaced and restored by Rollback.
+// Like PathHandler.Move, it falls back to a verified copy across devices.
+func (tx *Tx) Move(p PathHandler, destDir Dir) (PathHandler, error) {
+	return tx.move("move", p, destDir.Join(p.Name()))
+}
+
+func (tx *Tx) move(op string, p, dest PathHandler) (PathHandler, error) {
+	if err := tx.check(op, p); err != nil {
+		return "", err
+	}
+	if _, err := p.Lstat(); err != nil {
+		return "", err
+	}
+	if err := tx.backup(dest); err != nil {
+		return "", err
+	}
+	if err := movePath(p, dest); err != nil {
+		return "", err
+	}
+	tx.record(func() error {
+		return movePath(dest, p)
+	}, nil)
+	return dest, nil
+}
+
+// Delete removes p, which may be a file or a whole directory, by moving it to
+// a backup that Commit removes and Rollback moves back. Deleting a path that
+// does not exist fails.
+func (tx *Tx) Delete(p PathHandler) error {
+	if err := tx.check("delete", p); err != nil {
+		return err
+	}
+	if _, err := p.Lstat(); err != nil {
+		return err
+	}
+	return tx.backup(p)
+}
+
+// Commit makes the changes final by removing the backups. Failing to remove a
+// backup does not undo anything; the first such error is returned.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	var first error
+	for _, op := range tx.ops {
+		if op.commit == nil {
+			continue
+		}
+		if err := op.commit(); err != nil && first == nil {
+			first = err
+		}
+	}
+	tx.ops = nil
+	return first
+}
+
+// Rollback undoes every operation in reverse order, restoring replaced and
+// deleted entries. It keeps going when a step fails and returns the only
+// error, or a *MultiError holding all of them. After Commit it does nothing,
+// so it can be deferred.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return nil
+	}
+	tx.done = true
+	var errs []error
+	for i := len(tx.ops) - 1; i >= 0; i-- {
+		if err := tx.ops[i].undo(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	tx.ops = nil
+	return joinErrors(errs)
+}
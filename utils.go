@@ -1,6 +1,8 @@
 package easyFS
 
 import (
+	"context"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -46,3 +48,25 @@ func IsUnix() bool {
 func GetSeparator() rune {
 	return os.PathSeparator
 }
+
+// ctxErr returns ctx.Err() wrapped with the path where work stopped, or nil
+// while ctx is still active.
+func ctxErr(ctx context.Context, op string, p PathHandler) error {
+	if err := ctx.Err(); err != nil {
+		return &Error{Op: op, Path: p.String(), Err: err}
+	}
+	return nil
+}
+
+// ctxReader is an io.Reader that fails with ctx.Err() once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,193 @@
+package easyFS
+
+import (
+	"context"
+	"io/fs"
+	"iter"
+	"os"
+	"slices"
+	"sort"
+)
+
+// SkipDir can be returned by a WalkFunc to skip the directory it was called
+// for. Returned for a file, it skips the remaining entries of the directory
+// containing that file.
+var SkipDir = fs.SkipDir
+
+// SkipAll can be returned by a WalkFunc to stop the walk without an error.
+var SkipAll = fs.SkipAll
+
+// WalkEntry is a path visited by Walk.
+type WalkEntry struct {
+	// Path is the full path of the entry.
+	Path PathHandler
+	// Entry is the directory entry, or nil when a directory could not be read.
+	Entry os.DirEntry
+	// Depth is 1 for direct children of the walked directory, 2 for their children and so on.
+	Depth int
+}
+
+// IsDir reports whether the entry is a directory, without following symbolic links.
+func (e WalkEntry) IsDir() bool {
+	return e.Entry != nil && e.Entry.IsDir()
+}
+
+// Info returns information about the entry without following symbolic links.
+func (e WalkEntry) Info() (PathInfo, error) {
+	if e.Entry == nil {
+		return e.Path.Lstat()
+	}
+	info, err := e.Entry.Info()
+	if err != nil {
+		return nil, newError("lstat", e.Path, err)
+	}
+	return info, nil
+}
+
+// WalkFunc is called for every entry visited by Walk. When a directory cannot
+// be read it is called a second time for that directory with the error; the
+// walk continues if it returns nil or SkipDir and stops with any other error.
+type WalkFunc func(entry WalkEntry, err error) error
+
+// WalkOptions controls a walk.
+type WalkOptions struct {
+	// MaxDepth limits how deep the walk descends. 0 means no limit and 1 only visits direct children.
+	MaxDepth int
+	// FollowSymlinks makes the walk descend into symbolic links to directories.
+	// A link to a directory the walk is already inside is not descended into,
+	// and reported to the WalkFunc like an unreadable directory.
+	FollowSymlinks bool
+	// Ignore skips ignored paths entirely; ignored directories are not descended into.
+	Ignore *Ignore
+}
+
+// Walk visits every path below the directory in lexical order, depth first,
+// calling fn for each of them. The directory itself is not visited.
+//
+// Example:
+//
+//	dir := Dir{"/path/to/directory"}
+//	err := dir.Walk(func(entry WalkEntry, err error) error {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    if entry.IsDir() && entry.Path.Name() == "node_modules" {
+//	        return SkipDir
+//	    }
+//	    fmt.Println(entry.Path)
+//	    return nil
+//	})
+func (d Dir) Walk(fn WalkFunc) error {
+	return d.WalkContext(context.Background(), WalkOptions{}, fn)
+}
+
+// WalkContext is like Walk but honours opts and stops as soon as ctx is
+// cancelled, returning ctx.Err() wrapped with the path where it stopped.
+func (d Dir) WalkContext(ctx context.Context, opts WalkOptions, fn WalkFunc) error {
+	var ancestors []os.FileInfo
+	if opts.FollowSymlinks {
+		info, err := d.Stat()
+		if err == nil {
+			ancestors = []os.FileInfo{info}
+		}
+	}
+	err := d.walk(ctx, opts, 1, ancestors, fn)
+	if err == SkipDir || err == SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walk visits the entries of d. With FollowSymlinks, ancestors holds the
+// directories from the walked one down to d, to recognise symbolic link loops.
+func (d Dir) walk(ctx context.Context, opts WalkOptions, depth int, ancestors []os.FileInfo, fn WalkFunc) error {
+	if err := ctxErr(ctx, "walk", d.PathHandler); err != nil {
+		return err
+	}
+	entries, err := readDir(d.PathHandler)
+	if err != nil {
+		if err := fn(WalkEntry{Path: d.PathHandler, Depth: depth - 1}, err); err != nil && err != SkipDir {
+			return err
+		}
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		p := d.Join(entry.Name())
+		if err := ctxErr(ctx, "walk", p); err != nil {
+			return err
+		}
+		isDir := entry.IsDir() || (opts.FollowSymlinks && entry.Type()&os.ModeSymlink != 0 && p.IsDir())
+		if opts.Ignore.Match(p, isDir) {
+			continue
+		}
+		if err := fn(WalkEntry{Path: p, Entry: entry, Depth: depth}, nil); err != nil {
+			if err == SkipDir {
+				if isDir {
+					continue
+				}
+				return nil
+			}
+			return err
+		}
+		if !isDir || opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+			continue
+		}
+		branch := ancestors
+		if opts.FollowSymlinks {
+			info, err := p.Stat()
+			if err == nil && slices.ContainsFunc(ancestors, func(a os.FileInfo) bool { return sameFile(a, info) }) {
+				loop := &Error{Op: "walk", Path: p.String(), Err: errLoop}
+				if err := fn(WalkEntry{Path: p, Entry: entry, Depth: depth}, loop); err != nil && err != SkipDir {
+					return err
+				}
+				continue
+			}
+			if err == nil {
+				branch = append(ancestors[:len(ancestors):len(ancestors)], info)
+			}
+		}
+		if err := p.Dir().walk(ctx, opts, depth+1, branch, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameFile reports whether a and b describe the same file, by device and
+// inode on the OS and by node in a MemFileSystem.
+func sameFile(a, b os.FileInfo) bool {
+	if ma, ok := a.(memFileInfo); ok {
+		mb, ok := b.(memFileInfo)
+		return ok && ma.node == mb.node
+	}
+	return os.SameFile(a, b)
+}
+
+// WalkSeq returns the walk as an iterator that can be used with range over
+// func. Breaking out of the loop stops the walk. Errors reading directories
+// and the cancellation of ctx are yielded with the entry they belong to.
+//
+// Example:
+//
+//	for entry, err := range dir.WalkSeq(ctx, WalkOptions{MaxDepth: 2}) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(entry.Path)
+//	}
+func (d Dir) WalkSeq(ctx context.Context, opts WalkOptions) iter.Seq2[WalkEntry, error] {
+	return func(yield func(WalkEntry, error) bool) {
+		stopped := false
+		err := d.WalkContext(ctx, opts, func(entry WalkEntry, err error) error {
+			if !yield(entry, err) {
+				stopped = true
+				return SkipAll
+			}
+			return nil
+		})
+		if err != nil && !stopped {
+			yield(WalkEntry{Path: d.PathHandler}, err)
+		}
+	}
+}
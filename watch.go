@@ -0,0 +1,418 @@
+package easyFS
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchOp describes what happened to a watched path. Coalesced events can
+// carry several operations at once.
+type WatchOp uint32
+
+const (
+	// WatchCreate reports a new path, including the destination of a rename.
+	WatchCreate WatchOp = 1 << iota
+	// WatchWrite reports changed file content.
+	WatchWrite
+	// WatchRemove reports a deleted path.
+	WatchRemove
+	// WatchRename reports the old path of a renamed entry.
+	WatchRename
+	// WatchChmod reports changed permissions or other attributes.
+	WatchChmod
+)
+
+// Has reports whether op includes all operations of other.
+func (op WatchOp) Has(other WatchOp) bool {
+	return op&other == other
+}
+
+func (op WatchOp) String() string {
+	var names []string
+	for _, o := range []struct {
+		op   WatchOp
+		name string
+	}{{WatchCreate, "CREATE"}, {WatchWrite, "WRITE"}, {WatchRemove, "REMOVE"}, {WatchRename, "RENAME"}, {WatchChmod, "CHMOD"}} {
+		if op.Has(o.op) {
+			names = append(names, o.name)
+		}
+	}
+	if len(names) == 0 {
+		return "NONE"
+	}
+	return strings.Join(names, "|")
+}
+
+// WatchEvent is a change reported by a Watcher.
+type WatchEvent struct {
+	Path  PathHandler
+	Op    WatchOp
+	IsDir bool
+}
+
+func (e WatchEvent) String() string {
+	return e.Op.String() + " " + e.Path.String()
+}
+
+// WatchOptions controls Dir.Watch.
+type WatchOptions struct {
+	// Recursive also watches every subdirectory, including ones created later.
+	Recursive bool
+	// Pattern only reports paths matching it, relative to the watched directory.
+	Pattern *Pattern
+	// Ignore never reports ignored paths and does not watch ignored directories.
+	Ignore *Ignore
+	// Debounce coalesces the events of a path until nothing happened for this long. 0 reports every event at once.
+	Debounce time.Duration
+	// PollInterval is how often the polling watcher compares snapshots. It defaults to one second.
+	PollInterval time.Duration
+	// ForcePolling uses the portable polling watcher even where native notifications exist.
+	ForcePolling bool
+}
+
+// Watcher reports changes below a directory. Read Events until it is closed;
+// errors are sent to Errors and dropped when nobody reads them.
+type Watcher struct {
+	// Events receives the changes. It is closed by Close.
+	Events <-chan WatchEvent
+	// Errors receives errors from the underlying watcher. It is closed by Close.
+	Errors <-chan error
+
+	root   Dir
+	opts   WatchOptions
+	raw    chan WatchEvent
+	events chan WatchEvent
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+	source watchSource
+}
+
+// watchSource produces raw events for a Watcher.
+type watchSource interface {
+	close() error
+}
+
+// Watch starts watching the directory. On Linux the OS backend uses inotify;
+// everywhere else, or with ForcePolling, the directory is polled and changes
+// are detected by comparing size, modification time and mode. The polling
+// watcher reports renames as a removal and a creation. When inotify cannot
+// be set up, for instance because the limit of watches is reached, the error
+// is sent to Errors and the directory is polled instead; Polling tells which
+// way the watcher works.
+//
+// Example:
+//
+//	w, err := NewDir("/srv/inbox").Watch(WatchOptions{
+//	    Recursive: true,
+//	    Pattern:   MustCompilePattern("*.csv"),
+//	    Debounce:  200 * time.Millisecond,
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	defer w.Close()
+//	for event := range w.Events {
+//	    fmt.Println(event.Op, event.Path)
+//	}
+func (d Dir) Watch(opts WatchOptions) (*Watcher, error) {
+	info, err := d.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &Error{Op: "watch", Path: d.String(), Err: ErrNotDirectory}
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	w := &Watcher{
+		root:   d,
+		opts:   opts,
+		raw:    make(chan WatchEvent, 256),
+		events: make(chan WatchEvent, 64),
+		errors: make(chan error, 16),
+		done:   make(chan struct{}),
+	}
+	w.Events, w.Errors = w.events, w.errors
+	if _, isOS := d.FileSystem().(OSFileSystem); isOS && !opts.ForcePolling {
+		var err error
+		w.source, err = startNativeWatch(w)
+		if err != nil && !errors.Is(err, errors.ErrUnsupported) {
+			w.fail(newError("watch", d.PathHandler, err))
+		}
+	}
+	if w.source == nil {
+		w.source = startPollWatch(w)
+	}
+	w.wg.Add(1)
+	go w.dispatch()
+	return w, nil
+}
+
+// Polling reports whether the watcher polls the directory rather than
+// receiving native notifications.
+func (w *Watcher) Polling() bool {
+	_, polling := w.source.(*pollSource)
+	return polling
+}
+
+// Close stops the watcher and closes Events and Errors.
+func (w *Watcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		close(w.done)
+		err = w.source.close()
+		w.wg.Wait()
+		close(w.events)
+		close(w.errors)
+	})
+	return err
+}
+
+// emit hands a raw event to the dispatcher. It returns false once the watcher is closed.
+func (w *Watcher) emit(event WatchEvent) bool {
+	select {
+	case w.raw <- event:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// fail reports an error without blocking.
+func (w *Watcher) fail(err error) {
+	select {
+	case <-w.done:
+	case w.errors <- err:
+	default:
+	}
+}
+
+// accept applies the pattern and ignore rules.
+func (w *Watcher) accept(event WatchEvent) bool {
+	if w.opts.Ignore.Match(event.Path, event.IsDir) {
+		return false
+	}
+	if w.opts.Pattern != nil && !w.opts.Pattern.Match(w.root.rel(event.Path)) {
+		return false
+	}
+	return true
+}
+
+// walkOptions returns the options used to scan the watched tree.
+func (w *Watcher) walkOptions() WalkOptions {
+	opts := WalkOptions{Ignore: w.opts.Ignore}
+	if !w.opts.Recursive {
+		opts.MaxDepth = 1
+	}
+	return opts
+}
+
+// dispatch filters raw events, coalesces them and delivers them to Events.
+// Every path has its own deadline, so a path that keeps changing does not
+// hold back the events of the others.
+func (w *Watcher) dispatch() {
+	defer w.wg.Done()
+	type pendingEvent struct {
+		event    WatchEvent
+		deadline time.Time
+	}
+	var (
+		pending = map[PathHandler]*pendingEvent{}
+		order   []PathHandler
+		timer   *time.Timer
+		timerC  <-chan time.Time
+	)
+	send := func(event WatchEvent) bool {
+		select {
+		case w.events <- event:
+			return true
+		case <-w.done:
+			return false
+		}
+	}
+	// schedule arms the timer for the earliest deadline
+	schedule := func() {
+		var next time.Time
+		for _, p := range pending {
+			if next.IsZero() || p.deadline.Before(next) {
+				next = p.deadline
+			}
+		}
+		if next.IsZero() {
+			timerC = nil
+			return
+		}
+		if timer == nil {
+			timer = time.NewTimer(time.Until(next))
+		} else {
+			timer.Reset(time.Until(next))
+		}
+		timerC = timer.C
+	}
+	for {
+		select {
+		case event := <-w.raw:
+			if !w.accept(event) {
+				continue
+			}
+			if w.opts.Debounce <= 0 {
+				if !send(event) {
+					return
+				}
+				continue
+			}
+			deadline := time.Now().Add(w.opts.Debounce)
+			if existing, ok := pending[event.Path]; ok {
+				if existing.event.Op.Has(WatchCreate) && event.Op.Has(WatchRemove) {
+					// created and removed again within the window
+					delete(pending, event.Path)
+					order = slices.DeleteFunc(order, func(p PathHandler) bool { return p == event.Path })
+				} else {
+					existing.event.Op |= event.Op
+					existing.event.IsDir = existing.event.IsDir || event.IsDir
+					existing.deadline = deadline
+				}
+			} else {
+				pending[event.Path] = &pendingEvent{event, deadline}
+				order = append(order, event.Path)
+			}
+			schedule()
+		case <-timerC:
+			now := time.Now()
+			waiting := order[:0]
+			for _, p := range order {
+				event := pending[p]
+				if event.deadline.After(now) {
+					waiting = append(waiting, p)
+					continue
+				}
+				delete(pending, p)
+				if !send(event.event) {
+					return
+				}
+			}
+			order = waiting
+			schedule()
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+	}
+}
+
+// pollState is what the polling watcher remembers about a path.
+type pollState struct {
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+}
+
+type pollSource struct {
+	w *Watcher
+}
+
+func startPollWatch(w *Watcher) watchSource {
+	s := &pollSource{w: w}
+	previous := s.snapshot()
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.opts.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+				current := s.snapshot()
+				if !s.diff(previous, current) {
+					return
+				}
+				previous = current
+			}
+		}
+	}()
+	return s
+}
+
+func (s *pollSource) snapshot() map[PathHandler]pollState {
+	states := map[PathHandler]pollState{}
+	s.w.root.WalkContext(context.Background(), s.w.walkOptions(), func(entry WalkEntry, err error) error {
+		if err != nil {
+			if entry.Path != s.w.root.PathHandler || s.w.root.Exists() {
+				s.w.fail(err)
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		states[entry.Path] = pollState{size: info.Size(), modTime: info.ModTime(), mode: info.Mode()}
+		return nil
+	})
+	return states
+}
+
+// diff emits the changes between two snapshots in path order.
+func (s *pollSource) diff(previous, current map[PathHandler]pollState) bool {
+	var events []WatchEvent
+	for p, old := range previous {
+		if _, ok := current[p]; !ok {
+			events = append(events, WatchEvent{Path: p, Op: WatchRemove, IsDir: old.mode.IsDir()})
+		}
+	}
+	for p, state := range current {
+		old, ok := previous[p]
+		isDir := state.mode.IsDir()
+		switch {
+		case !ok:
+			events = append(events, WatchEvent{Path: p, Op: WatchCreate, IsDir: isDir})
+		case old.mode.Type() != state.mode.Type():
+			events = append(events, WatchEvent{Path: p, Op: WatchRemove, IsDir: old.mode.IsDir()}, WatchEvent{Path: p, Op: WatchCreate, IsDir: isDir})
+		default:
+			var op WatchOp
+			if !isDir && (old.size != state.size || !old.modTime.Equal(state.modTime)) {
+				op |= WatchWrite
+			}
+			if old.mode.Perm() != state.mode.Perm() {
+				op |= WatchChmod
+			}
+			if op != 0 {
+				events = append(events, WatchEvent{Path: p, Op: op, IsDir: isDir})
+			}
+		}
+	}
+	sortWatchEvents(events)
+	for _, event := range events {
+		if !s.w.emit(event) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *pollSource) close() error {
+	return nil
+}
+
+// sortWatchEvents orders events by path, keeping removals before creations.
+func sortWatchEvents(events []WatchEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Path != events[j].Path {
+			return events[i].Path < events[j].Path
+		}
+		return events[i].Op.Has(WatchRemove) && !events[j].Op.Has(WatchRemove)
+	})
+}
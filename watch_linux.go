@@ -0,0 +1,176 @@
+//go:build linux
+
+package easyFS
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_DELETE | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// inotifySource watches a tree with Linux inotify, one watch per directory.
+type inotifySource struct {
+	w    *Watcher
+	fd   int
+	file *os.File
+
+	mu      sync.Mutex
+	watches map[int32]PathHandler
+}
+
+func startNativeWatch(w *Watcher) (watchSource, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	s := &inotifySource{
+		w:       w,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: map[int32]PathHandler{},
+	}
+	if err := s.add(w.root.PathHandler); err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	if w.opts.Recursive {
+		s.addTree(w.root, false)
+	}
+	w.wg.Add(1)
+	go s.read()
+	return s, nil
+}
+
+func (s *inotifySource) add(dir PathHandler) error {
+	wd, err := syscall.InotifyAddWatch(s.fd, dir.String(), inotifyMask)
+	if err != nil {
+		return &Error{Op: "inotify_add_watch", Path: dir.String(), Err: err}
+	}
+	s.mu.Lock()
+	s.watches[int32(wd)] = dir
+	s.mu.Unlock()
+	return nil
+}
+
+// addTree watches every directory below dir. With report set it also emits a
+// creation for every entry, since they may have appeared before the watch.
+func (s *inotifySource) addTree(dir Dir, report bool) {
+	dir.WalkContext(context.Background(), s.w.walkOptions(), func(entry WalkEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if report && !s.w.emit(WatchEvent{Path: entry.Path, Op: WatchCreate, IsDir: entry.IsDir()}) {
+			return SkipAll
+		}
+		if entry.IsDir() {
+			if err := s.add(entry.Path); err != nil {
+				s.w.fail(err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *inotifySource) read() {
+	defer s.w.wg.Done()
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := s.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				s.w.fail(err)
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[offset:]))
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			length := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+			start := offset + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[start:start+length], "\x00"))
+			offset = start + length
+			if !s.handle(wd, mask, name) {
+				return
+			}
+		}
+	}
+}
+
+// handle turns one inotify record into events. It returns false once the watcher is closed.
+func (s *inotifySource) handle(wd int32, mask uint32, name string) bool {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		s.w.fail(errors.New("easyFS: inotify event queue overflowed, events were lost"))
+		return true
+	}
+	s.mu.Lock()
+	dir, ok := s.watches[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(s.watches, wd)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return true
+	}
+	if name == "" {
+		// events about a watched directory itself are reported by its parent,
+		// except for the root
+		if dir == s.w.root.PathHandler && mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 {
+			return s.w.emit(WatchEvent{Path: dir, Op: WatchRemove, IsDir: true})
+		}
+		return true
+	}
+	event := WatchEvent{Path: dir.Join(name), IsDir: mask&syscall.IN_ISDIR != 0}
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		event.Op = WatchCreate
+	case mask&syscall.IN_MODIFY != 0:
+		event.Op = WatchWrite
+	case mask&syscall.IN_DELETE != 0:
+		event.Op = WatchRemove
+	case mask&syscall.IN_MOVED_FROM != 0:
+		event.Op = WatchRename
+	case mask&syscall.IN_ATTRIB != 0:
+		event.Op = WatchChmod
+	default:
+		return true
+	}
+	if !s.w.emit(event) {
+		return false
+	}
+	if event.Op == WatchRename && event.IsDir {
+		// a directory moved within the tree is watched again under its new name
+		s.drop(event.Path)
+	}
+	if event.Op == WatchCreate && event.IsDir && s.w.opts.Recursive && !s.w.opts.Ignore.Match(event.Path, true) {
+		if err := s.add(event.Path); err != nil {
+			s.w.fail(err)
+			return true
+		}
+		s.addTree(event.Path.Dir(), true)
+	}
+	return true
+}
+
+// drop stops watching dir and every directory below it, so that events from
+// a directory moved away are not reported under its old path.
+func (s *inotifySource) drop(dir PathHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for wd, p := range s.watches {
+		if hasPathPrefix(p.String(), dir.String()) {
+			syscall.InotifyRmWatch(s.fd, uint32(wd))
+			delete(s.watches, wd)
+		}
+	}
+}
+
+func (s *inotifySource) close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package easyFS
+
+import "errors"
+
+// startNativeWatch reports that native notifications are not available, so
+// Watch falls back to polling.
+func startNativeWatch(w *Watcher) (watchSource, error) {
+	return nil, errors.ErrUnsupported
+}